@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"civicsync-be/config"
+	"civicsync-be/models"
+	authUtils "civicsync-be/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UpdateUserRole assigns a role to a user and signs them out so the new role applies immediately
+func UpdateUserRole(c *gin.Context) {
+	targetID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var input struct {
+		Role string `json:"role" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role := models.Role(input.Role)
+	if !role.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+
+	if userID, _ := c.Get("user_id"); userID == targetID.Hex() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot change your own role"})
+		return
+	}
+
+	userCollection := config.GetCollection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := userCollection.UpdateOne(ctx, bson.M{"_id": targetID}, bson.M{"$set": bson.M{
+		"role":      role,
+		"updatedAt": time.Now(),
+	}})
+	if err != nil {
+		log.Println("Error updating user role:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := authUtils.RevokeAllSessions(targetID.Hex()); err != nil {
+		log.Println("Error revoking sessions after role change:", err)
+	}
+	if err := revokeAPIKeys(ctx, targetID); err != nil {
+		log.Println("Error revoking API keys after role change:", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User role updated successfully",
+		"id":      targetID,
+		"role":    role,
+	})
+}
+
+// UpdateTwoFactorRequirement makes two-factor authentication mandatory for a user, or optional again.
+// Requiring it signs the user out so their next login asks for a code.
+func UpdateTwoFactorRequirement(c *gin.Context) {
+	targetID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var input struct {
+		Required *bool `json:"required" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userCollection := config.GetCollection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := userCollection.UpdateOne(ctx, bson.M{"_id": targetID}, bson.M{"$set": bson.M{
+		"twoFactorRequired": *input.Required,
+		"updatedAt":         time.Now(),
+	}})
+	if err != nil {
+		log.Println("Error updating two-factor requirement:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if *input.Required {
+		if err := authUtils.RevokeAllSessions(targetID.Hex()); err != nil {
+			log.Println("Error revoking sessions after requiring two-factor authentication:", err)
+		}
+		if err := revokeAPIKeys(ctx, targetID); err != nil {
+			log.Println("Error revoking API keys after requiring two-factor authentication:", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":           "Two-factor requirement updated successfully",
+		"id":                targetID,
+		"twoFactorRequired": *input.Required,
+	})
+}
+
+// GetLoginLockouts lists recent login lockouts so admins can spot attacked accounts
+func GetLoginLockouts(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	filter := bson.M{}
+	if scope := c.Query("scope"); scope != "" {
+		filter["scope"] = scope
+	}
+	if subject := c.Query("subject"); subject != "" {
+		filter["subject"] = subject
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	lockoutCollection := config.GetCollection("login_lockouts")
+	totalCount, err := lockoutCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count lockouts"})
+		return
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+
+	cursor, err := lockoutCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve lockouts"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	lockouts := []models.LoginLockout{}
+	if err := cursor.All(ctx, &lockouts); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode lockouts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"lockouts":      lockouts,
+		"totalLockouts": totalCount,
+		"totalPages":    int((totalCount + int64(limit) - 1) / int64(limit)),
+		"currentPage":   page,
+	})
+}
@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"civicsync-be/config"
+	"civicsync-be/models"
+	authUtils "civicsync-be/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var apiKeyCollection = config.GetCollection("api_keys")
+
+// Keys expire after apiKeyDefaultTTLDays unless the owner picks a shorter or longer lifetime, up to a year
+const apiKeyDefaultTTLDays = 90
+
+// CreateAPIKey creates an API key for the authenticated user. The plain key is only returned once.
+// A key outlives sessions, so the user has to prove their identity again to create one.
+func CreateAPIKey(c *gin.Context) {
+	var input struct {
+		Name          string   `json:"name" binding:"required,max=100"`
+		Organization  string   `json:"organization,omitempty" binding:"max=100"`
+		Scopes        []string `json:"scopes" binding:"required,min=1"`
+		ExpiresInDays *int     `json:"expiresInDays,omitempty" binding:"omitempty,min=1,max=365"`
+		reauthentication
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	userObjID := user.ID
+
+	verified, err := verifyReauthentication(user, input.reauthentication)
+	if err != nil {
+		log.Println("Error checking reauthentication:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+	if !verified {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Confirm your password, a verification code or the emailed link to create an API key"})
+		return
+	}
+
+	scopes := make([]models.APIKeyScope, 0, len(input.Scopes))
+	for _, s := range input.Scopes {
+		scope := models.APIKeyScope(s)
+		if !scope.IsValid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope: " + s})
+			return
+		}
+		scopes = append(scopes, scope)
+	}
+
+	key, prefix, keyHash, err := authUtils.GenerateAPIKey()
+	if err != nil {
+		log.Println("Error generating API key:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	apiKey := models.APIKey{
+		ID:           primitive.NewObjectID(),
+		Name:         input.Name,
+		Organization: input.Organization,
+		Prefix:       prefix,
+		KeyHash:      keyHash,
+		User:         userObjID,
+		Scopes:       scopes,
+		CreatedAt:    time.Now(),
+	}
+	expiresInDays := apiKeyDefaultTTLDays
+	if input.ExpiresInDays != nil {
+		expiresInDays = *input.ExpiresInDays
+	}
+	expiresAt := time.Now().AddDate(0, 0, expiresInDays)
+	apiKey.ExpiresAt = &expiresAt
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := apiKeyCollection.InsertOne(ctx, apiKey); err != nil {
+		log.Println("Error inserting API key:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"apiKey": apiKey,
+		"key":    key,
+	})
+}
+
+// GetAPIKeys lists the authenticated user's API keys without their secrets
+func GetAPIKeys(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userObjID, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := apiKeyCollection.Find(ctx, bson.M{"user": userObjID}, findOptions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve API keys"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	apiKeys := []models.APIKey{}
+	if err := cursor.All(ctx, &apiKeys); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode API keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, apiKeys)
+}
+
+// RevokeAPIKey revokes one of the authenticated user's API keys
+func RevokeAPIKey(c *gin.Context) {
+	keyID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userObjID, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := apiKeyCollection.UpdateOne(ctx,
+		bson.M{"_id": keyID, "user": userObjID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked successfully"})
+}
+
+// revokeAPIKeys revokes all of a user's active keys. Keys act with the owner's current role and skip the
+// second factor, so they are revoked whenever the owner's credentials or privileges change.
+func revokeAPIKeys(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := apiKeyCollection.UpdateMany(ctx,
+		bson.M{"user": userID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	return err
+}
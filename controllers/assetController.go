@@ -0,0 +1,302 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"civicsync-be/config"
+	"civicsync-be/media"
+	"civicsync-be/models"
+	"civicsync-be/storage"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var assetCollection *mongo.Collection = config.GetCollection("assets")
+
+// errPhotoUnavailable is returned when a photo does not exist, belongs to someone else or is already attached
+var errPhotoUnavailable = errors.New("photo not found or already attached to an issue")
+
+// assetResponse is an asset along with the URLs it is served from
+type assetResponse struct {
+	models.Asset
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnailUrl"`
+	// SuggestedLocation is offered to the uploader only, right after the upload
+	SuggestedLocation *models.PhotoLocation `json:"suggestedLocation,omitempty"`
+}
+
+func newAssetResponse(asset models.Asset) assetResponse {
+	return assetResponse{
+		Asset:        asset,
+		URL:          "/api/assets/" + asset.ID.Hex(),
+		ThumbnailURL: "/api/assets/" + asset.ID.Hex() + "/thumbnail",
+	}
+}
+
+// UploadAsset accepts a photo as the "file" field of a multipart form.
+// The photo is validated by its content, stripped of metadata and stored with a thumbnail;
+// its ID can then be attached to an issue, either when reporting it or through the attachment routes.
+func UploadAsset(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ownerID, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	// Leave some room for the multipart framing around the file itself
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, media.MaxUploadSize+64<<10)
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Photos can be at most 10 MB"})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A photo must be uploaded as the file field"})
+		}
+		return
+	}
+	defer file.Close()
+
+	if header.Size > media.MaxUploadSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Photos can be at most 10 MB"})
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, media.MaxUploadSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read photo"})
+		return
+	}
+	if len(data) > media.MaxUploadSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Photos can be at most 10 MB"})
+		return
+	}
+
+	img, err := media.Process(data)
+	if err != nil {
+		switch err {
+		case media.ErrUnsupportedType:
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		case media.ErrInvalidImage, media.ErrTooManyPixels:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			log.Println("Error processing photo:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process photo"})
+		}
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	id := primitive.NewObjectID()
+	asset := models.Asset{
+		ID:           id,
+		Owner:        ownerID,
+		ContentType:  img.ContentType,
+		Size:         int64(len(img.Data)),
+		Width:        img.Width,
+		Height:       img.Height,
+		Key:          "assets/" + id.Hex() + "/original" + img.Extension,
+		ThumbnailKey: "assets/" + id.Hex() + "/thumbnail" + img.Extension,
+		CreatedAt:    time.Now(),
+	}
+	if img.Location != nil {
+		asset.Location = &models.PhotoLocation{
+			Latitude:   img.Location.Latitude,
+			Longitude:  img.Location.Longitude,
+			CapturedAt: img.Location.CapturedAt,
+		}
+	}
+
+	store := storage.Default()
+	if err := store.Put(ctx, asset.Key, img.Data, asset.ContentType); err != nil {
+		log.Println("Error storing photo:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store photo"})
+		return
+	}
+	if err := store.Put(ctx, asset.ThumbnailKey, img.Thumbnail, asset.ContentType); err != nil {
+		log.Println("Error storing thumbnail:", err)
+		_ = store.Delete(ctx, asset.Key)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store photo"})
+		return
+	}
+
+	if _, err := assetCollection.InsertOne(ctx, asset); err != nil {
+		_ = store.Delete(ctx, asset.Key)
+		_ = store.Delete(ctx, asset.ThumbnailKey)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save photo"})
+		return
+	}
+
+	response := newAssetResponse(asset)
+	response.SuggestedLocation = asset.Location
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetAsset serves an uploaded photo
+func GetAsset(c *gin.Context) {
+	serveAsset(c, false)
+}
+
+// GetAssetThumbnail serves the thumbnail of an uploaded photo
+func GetAssetThumbnail(c *gin.Context) {
+	serveAsset(c, true)
+}
+
+// serveAsset streams a photo from the blob store. Photos attached to an issue are public;
+// photos not attached yet are only visible to the user who uploaded them.
+func serveAsset(c *gin.Context, thumbnail bool) {
+	assetID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid asset ID"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	var asset models.Asset
+	err = assetCollection.FindOne(ctx, bson.M{"_id": assetID}).Decode(&asset)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Asset not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve asset"})
+		}
+		return
+	}
+
+	cacheControl := "public, max-age=31536000, immutable"
+	if asset.Issue == nil {
+		userID, _ := c.Get("user_id")
+		if id, ok := userID.(string); !ok || id != asset.Owner.Hex() {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Asset not found"})
+			return
+		}
+		cacheControl = "private, no-store"
+	}
+
+	key, size := asset.Key, asset.Size
+	if thumbnail {
+		key, size = asset.ThumbnailKey, -1
+	}
+
+	body, err := storage.Default().Get(ctx, key)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Asset not found"})
+		} else {
+			log.Println("Error reading photo:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read asset"})
+		}
+		return
+	}
+	defer body.Close()
+
+	c.DataFromReader(http.StatusOK, size, asset.ContentType, body, map[string]string{
+		"Cache-Control":          cacheControl,
+		"X-Content-Type-Options": "nosniff",
+	})
+}
+
+// attachPhoto claims an unattached photo uploaded by owner for an issue. The GPS location of the photo is
+// removed from the asset in the same update and returned, so it is kept only until the photo is used.
+func attachPhoto(ctx context.Context, photoID string, owner, issueID primitive.ObjectID) (primitive.ObjectID, *models.PhotoLocation, error) {
+	assetID, err := primitive.ObjectIDFromHex(photoID)
+	if err != nil {
+		return primitive.NilObjectID, nil, errPhotoUnavailable
+	}
+
+	var asset models.Asset
+	err = assetCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": assetID, "owner": owner, "issue": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"issue": issueID}, "$unset": bson.M{"location": ""}},
+	).Decode(&asset)
+	if err == mongo.ErrNoDocuments {
+		return primitive.NilObjectID, nil, errPhotoUnavailable
+	}
+	if err != nil {
+		return primitive.NilObjectID, nil, err
+	}
+
+	return assetID, asset.Location, nil
+}
+
+// detachPhoto releases a photo claimed by attachPhoto when the issue change that needed it fails
+func detachPhoto(ctx context.Context, assetID primitive.ObjectID) {
+	_, _ = assetCollection.UpdateOne(ctx, bson.M{"_id": assetID}, bson.M{"$unset": bson.M{"issue": ""}})
+}
+
+// deleteAssets removes the matching assets and their files from the blob store
+func deleteAssets(ctx context.Context, filter bson.M) error {
+	cursor, err := assetCollection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	var assets []models.Asset
+	if err := cursor.All(ctx, &assets); err != nil {
+		return err
+	}
+
+	store := storage.Default()
+	for _, asset := range assets {
+		if err := store.Delete(ctx, asset.Key); err != nil {
+			log.Printf("Error deleting photo %s: %v", asset.ID.Hex(), err)
+			continue
+		}
+		if err := store.Delete(ctx, asset.ThumbnailKey); err != nil {
+			log.Printf("Error deleting thumbnail of photo %s: %v", asset.ID.Hex(), err)
+		}
+		if _, err := assetCollection.DeleteOne(ctx, bson.M{"_id": asset.ID}); err != nil {
+			log.Printf("Error deleting photo %s: %v", asset.ID.Hex(), err)
+		}
+	}
+
+	return nil
+}
+
+// RunAssetCleanup periodically removes photos that were uploaded but never attached to an issue
+func RunAssetCleanup(interval time.Duration) {
+	for {
+		purgeUnattachedAssets()
+		time.Sleep(interval)
+	}
+}
+
+func purgeUnattachedAssets() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	err := deleteAssets(ctx, bson.M{
+		"issue":     bson.M{"$exists": false},
+		"createdAt": bson.M{"$lte": time.Now().Add(-models.UnattachedAssetTTL)},
+	})
+	if err != nil {
+		log.Println("Error purging unattached photos:", err)
+	}
+}
+
+// respondPhotoError reports a failure to attach a photo to an issue
+func respondPhotoError(c *gin.Context, err error) {
+	if err == errPhotoUnavailable {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Photo not found or already attached to an issue"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to attach photo"})
+}
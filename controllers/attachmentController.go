@@ -0,0 +1,358 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"civicsync-be/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// attachmentInput names an uploaded photo to attach to an issue
+type attachmentInput struct {
+	AssetID string `json:"assetId" binding:"required"`
+	Caption string `json:"caption,omitempty" binding:"max=200"`
+}
+
+// attachmentResponse is an attachment along with the photo it shows and its uploader as the viewer may see them
+type attachmentResponse struct {
+	models.Attachment
+	UploadedBy   models.PublicUser `json:"uploadedBy"`
+	URL          string            `json:"url"`
+	ThumbnailURL string            `json:"thumbnailUrl"`
+	Width        int               `json:"width"`
+	Height       int               `json:"height"`
+}
+
+// AddIssueAttachment attaches an uploaded photo to an issue.
+// Reporters and moderators add report photos; officials add progress and resolution photos.
+func AddIssueAttachment(c *gin.Context) {
+	issue, userObjID, ok := loadAttachmentIssue(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		attachmentInput
+		Kind models.AttachmentKind `json:"kind,omitempty"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Kind == "" {
+		input.Kind = models.AttachmentReport
+	}
+	if !input.Kind.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment kind"})
+		return
+	}
+
+	role := currentUserRole(c)
+	if input.Kind.RequiresOfficial() {
+		if !role.CanChangeIssueStatus() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only officials can attach " + string(input.Kind) + " photos"})
+			return
+		}
+	} else if issue.CreatedBy != userObjID && !role.CanModerateIssues() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the creator or a moderator can attach report photos to this issue"})
+		return
+	}
+
+	if len(issue.Attachments) >= models.MaxIssueAttachments {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An issue can have at most " + strconv.Itoa(models.MaxIssueAttachments) + " photos"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Only the reporter's photos can place an issue, so the location of later photos is discarded
+	assetID, _, err := attachPhoto(ctx, input.AssetID, userObjID, issue.ID)
+	if err != nil {
+		respondPhotoError(c, err)
+		return
+	}
+
+	attachment := models.Attachment{
+		Asset:      assetID,
+		Kind:       input.Kind,
+		UploadedBy: userObjID,
+		Caption:    strings.TrimSpace(input.Caption),
+		Order:      len(issue.Attachments),
+		AddedAt:    time.Now(),
+	}
+
+	result, err := issueCollection.UpdateOne(ctx, attachmentsUnchanged(issue), bson.M{
+		"$push": bson.M{"attachments": attachment},
+		"$set":  bson.M{"updatedAt": time.Now()},
+	})
+	if err != nil || result.MatchedCount == 0 {
+		detachPhoto(ctx, assetID)
+		respondAttachmentUpdateError(c, err)
+		return
+	}
+
+	issue.Attachments = append(issue.Attachments, attachment)
+	c.JSON(http.StatusCreated, issueAttachments(ctx, *issue, newCreatorLookup(c)))
+}
+
+// ReorderIssueAttachments sets the display order of an issue's photos; assetIds must list every attached photo
+func ReorderIssueAttachments(c *gin.Context) {
+	issue, userObjID, ok := loadAttachmentIssue(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		AssetIDs []string `json:"assetIds" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role := currentUserRole(c)
+	if issue.CreatedBy != userObjID && !role.CanModerateIssues() && !role.CanChangeIssueStatus() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to reorder the photos of this issue"})
+		return
+	}
+
+	byAsset := make(map[string]models.Attachment, len(issue.Attachments))
+	for _, attachment := range issue.Attachments {
+		byAsset[attachment.Asset.Hex()] = attachment
+	}
+
+	if len(input.AssetIDs) != len(issue.Attachments) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "assetIds must list every photo of the issue exactly once"})
+		return
+	}
+	reordered := make([]models.Attachment, 0, len(input.AssetIDs))
+	for i, id := range input.AssetIDs {
+		attachment, ok := byAsset[id]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "assetIds must list every photo of the issue exactly once"})
+			return
+		}
+		delete(byAsset, id)
+		attachment.Order = i
+		reordered = append(reordered, attachment)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := issueCollection.UpdateOne(ctx, attachmentsUnchanged(issue), bson.M{
+		"$set": bson.M{"attachments": reordered, "updatedAt": time.Now()},
+	})
+	if err != nil || result.MatchedCount == 0 {
+		respondAttachmentUpdateError(c, err)
+		return
+	}
+
+	issue.Attachments = reordered
+	c.JSON(http.StatusOK, issueAttachments(ctx, *issue, newCreatorLookup(c)))
+}
+
+// RemoveIssueAttachment removes a photo from an issue and deletes it; the uploader or a moderator may remove it
+func RemoveIssueAttachment(c *gin.Context) {
+	issue, userObjID, ok := loadAttachmentIssue(c)
+	if !ok {
+		return
+	}
+
+	assetID, err := primitive.ObjectIDFromHex(c.Param("assetId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid asset ID"})
+		return
+	}
+
+	var removed *models.Attachment
+	remaining := make([]models.Attachment, 0, len(issue.Attachments))
+	for _, attachment := range issue.Attachments {
+		if attachment.Asset == assetID {
+			removed = &attachment
+			continue
+		}
+		attachment.Order = len(remaining)
+		remaining = append(remaining, attachment)
+	}
+
+	if removed == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+	if removed.UploadedBy != userObjID && !currentUserRole(c).CanModerateIssues() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to remove this photo"})
+		return
+	}
+
+	filter := attachmentsUnchanged(issue)
+	if resolutionPhotoRequired() && removed.Kind == models.AttachmentResolution &&
+		!hasAttachmentKind(models.Issue{Attachments: remaining}, models.AttachmentResolution) {
+		if issue.Status == models.Resolved {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A resolved issue must keep at least one resolution photo"})
+			return
+		}
+		// Also keeps the issue from being resolved while its last resolution photo is being removed
+		filter["status"] = bson.M{"$ne": models.Resolved}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := issueCollection.UpdateOne(ctx, filter, bson.M{
+		"$set": bson.M{"attachments": remaining, "updatedAt": time.Now()},
+	})
+	if err != nil || result.MatchedCount == 0 {
+		respondAttachmentUpdateError(c, err)
+		return
+	}
+
+	if err := deleteAssets(ctx, bson.M{"_id": assetID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Photo removed but could not be deleted"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Photo removed successfully"})
+}
+
+// loadAttachmentIssue loads the issue named in the URL together with the authenticated user's ID
+func loadAttachmentIssue(c *gin.Context) (*models.Issue, primitive.ObjectID, bool) {
+	issueID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid issue ID"})
+		return nil, primitive.NilObjectID, false
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, primitive.NilObjectID, false
+	}
+
+	userObjID, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, primitive.NilObjectID, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var issue models.Issue
+	err = issueCollection.FindOne(ctx, bson.M{"_id": issueID}).Decode(&issue)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Issue not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve issue"})
+		}
+		return nil, primitive.NilObjectID, false
+	}
+
+	return &issue, userObjID, true
+}
+
+// attachmentsUnchanged matches the issue only while its attachments are still the ones that were loaded,
+// so concurrent edits to the photos cannot overwrite each other
+func attachmentsUnchanged(issue *models.Issue) bson.M {
+	if len(issue.Attachments) == 0 {
+		return bson.M{"_id": issue.ID, "$or": bson.A{
+			bson.M{"attachments": bson.M{"$exists": false}},
+			bson.M{"attachments": bson.M{"$size": 0}},
+		}}
+	}
+	return bson.M{"_id": issue.ID, "attachments": issue.Attachments}
+}
+
+func respondAttachmentUpdateError(c *gin.Context, err error) {
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update attachments"})
+		return
+	}
+	c.JSON(http.StatusConflict, gin.H{"error": "The photos of this issue changed in the meantime, please reload it"})
+}
+
+// detachAttachments releases photos claimed for an issue that could not be saved
+func detachAttachments(ctx context.Context, attachments []models.Attachment) {
+	for _, attachment := range attachments {
+		detachPhoto(ctx, attachment.Asset)
+	}
+}
+
+// issueAttachments returns the photos of an issue in display order
+func issueAttachments(ctx context.Context, issue models.Issue, people *creatorLookup) []attachmentResponse {
+	response := make([]attachmentResponse, 0, len(issue.Attachments))
+	if len(issue.Attachments) == 0 {
+		return response
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(issue.Attachments))
+	uploaders := make([]primitive.ObjectID, 0, len(issue.Attachments))
+	for _, attachment := range issue.Attachments {
+		ids = append(ids, attachment.Asset)
+		uploaders = append(uploaders, attachment.UploadedBy)
+	}
+	people.prefetch(ctx, uploaders)
+
+	assets := make(map[primitive.ObjectID]models.Asset, len(ids))
+	cursor, err := assetCollection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err == nil {
+		var found []models.Asset
+		if cursor.All(ctx, &found) == nil {
+			for _, asset := range found {
+				assets[asset.ID] = asset
+			}
+		}
+	}
+
+	for _, attachment := range issue.Attachments {
+		asset, ok := assets[attachment.Asset]
+		if !ok {
+			continue
+		}
+		urls := newAssetResponse(asset)
+		response = append(response, attachmentResponse{
+			Attachment:   attachment,
+			UploadedBy:   people.creator(ctx, attachment.UploadedBy),
+			URL:          urls.URL,
+			ThumbnailURL: urls.ThumbnailURL,
+			Width:        asset.Width,
+			Height:       asset.Height,
+		})
+	}
+
+	sort.SliceStable(response, func(i, j int) bool {
+		return response[i].Order < response[j].Order
+	})
+	return response
+}
+
+// hasAttachmentKind reports whether the issue carries at least one photo of the given kind
+func hasAttachmentKind(issue models.Issue, kind models.AttachmentKind) bool {
+	for _, attachment := range issue.Attachments {
+		if attachment.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// resolutionPhotoRequired reports whether issues can only be resolved with a resolution photo attached,
+// as set by REQUIRE_RESOLUTION_PHOTO
+func resolutionPhotoRequired() bool {
+	return os.Getenv("REQUIRE_RESOLUTION_PHOTO") == "true"
+}
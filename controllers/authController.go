@@ -2,18 +2,24 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"log"
+	"math"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"time"
 
 	"civicsync-be/config"
+	"civicsync-be/mailer"
 	"civicsync-be/models"
 	authUtils "civicsync-be/utils"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // RegisterUser handles user registration
@@ -28,6 +34,7 @@ func RegisterUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	input.Email = models.NormalizeEmail(input.Email)
 
 	userCollection := config.GetCollection("users")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -40,7 +47,7 @@ func RegisterUser(c *gin.Context) {
 		return
 	}
 	if count > 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User with this email already exists"})
+		respondEmailTaken(c)
 		return
 	}
 
@@ -48,6 +55,7 @@ func RegisterUser(c *gin.Context) {
 		Name:      input.Name,
 		Email:     input.Email,
 		Password:  input.Password,
+		Role:      models.RoleCitizen,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
@@ -58,17 +66,29 @@ func RegisterUser(c *gin.Context) {
 		return
 	}
 
+	// The unique index catches registrations racing past the check above
 	result, err := userCollection.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		respondEmailTaken(c)
+		return
+	}
 	if err != nil {
 		log.Println("Error inserting user:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
 		return
 	}
 
+	user.ID = result.InsertedID.(primitive.ObjectID)
+	if err := sendVerificationEmail(user); err != nil {
+		log.Println("Error sending verification email:", err)
+	}
+
 	c.JSON(http.StatusCreated, gin.H{
 		"id":        result.InsertedID,
 		"name":      user.Name,
 		"email":     user.Email,
+		"verified":  user.Verified,
+		"role":      user.Role,
 		"createdAt": user.CreatedAt,
 	})
 }
@@ -78,6 +98,9 @@ func LoginUser(c *gin.Context) {
 	var input struct {
 		Email    string `json:"email" binding:"required,email"`
 		Password string `json:"password" binding:"required"`
+		Device   string `json:"device,omitempty" binding:"max=100"`
+		// Native clients that cannot use cookies ask for the tokens in the response body
+		ReturnTokens bool `json:"returnTokens,omitempty"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -85,53 +108,143 @@ func LoginUser(c *gin.Context) {
 		return
 	}
 
+	input.Email = models.NormalizeEmail(input.Email)
+
+	clientIP := c.ClientIP()
+	locked, err := authUtils.LoginLockRemaining(input.Email, clientIP)
+	if err != nil {
+		log.Println("Error checking login lock:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+	if locked > 0 {
+		respondLoginLocked(c, locked)
+		return
+	}
+
 	userCollection := config.GetCollection("users")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	var user models.User
-	err := userCollection.FindOne(ctx, bson.M{"email": input.Email}).Decode(&user)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	err = userCollection.FindOne(ctx, bson.M{"email": input.Email}).Decode(&user)
+	if err != nil || !user.ComparePassword(input.Password) {
+		handleFailedLogin(c, input.Email, clientIP)
 		return
 	}
 
-	if !user.ComparePassword(input.Password) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	// Failed attempts are only forgotten once the whole login, second factor included, succeeded
+	completeLogin(c, user, input.Device, input.ReturnTokens)
+}
+
+// completeLogin finishes the first login step: accounts with two-factor authentication get a challenge,
+// everyone else a new session
+func completeLogin(c *gin.Context, user models.User, device string, returnTokens bool) {
+	if user.TwoFactorEnabled || user.TwoFactorRequired {
+		respondTwoFactorChallenge(c, user)
 		return
 	}
 
-	token, err := authUtils.GenerateAndSetToken(user.ID.Hex())
+	response, err := startLoginSession(c, user, device, returnTokens)
 	if err != nil {
 		log.Println("Error generating token:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
 		return
 	}
-	environment := os.Getenv("GO_ENV")
-	domain := os.Getenv("DOMAIN")
 
-	// For production, don't set domain to allow cross-origin cookies
-	if environment == "production" {
-		domain = ""
+	c.JSON(http.StatusOK, response)
+}
+
+// startLoginSession starts a session for a fully authenticated user and hands out its tokens as cookies or in the body
+func startLoginSession(c *gin.Context, user models.User, device string, returnTokens bool) (gin.H, error) {
+	tokens, err := issueAuthTokens(c, user, device)
+	if err != nil {
+		return nil, err
 	}
 
-	cookie := &http.Cookie{
-		Name:     "auth_token",
-		Value:    token,
-		MaxAge:   3600, // 1 hour
-		Path:     "/",
-		Domain:   domain,
-		Secure:   environment == "production", // false for HTTP (dev), true for HTTPS (prod)
-		HttpOnly: true,                        // still protect from JS access
-		SameSite: http.SameSiteNoneMode,       // Required for cross-origin cookies in production
+	if err := authUtils.ResetLoginFailures(user.Email); err != nil {
+		log.Println("Error resetting login failures:", err)
 	}
-	http.SetCookie(c.Writer, cookie)
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"id":        user.ID,
 		"name":      user.Name,
 		"email":     user.Email,
+		"verified":  user.Verified,
+		"role":      user.Role,
 		"createdAt": user.CreatedAt,
+	}
+	if returnTokens {
+		addTokensToResponse(response, tokens)
+	} else {
+		setAuthCookies(c, tokens)
+	}
+
+	return response, nil
+}
+
+// handleFailedLogin counts a failed login and responds with 401, or 429 once the account or IP gets locked
+func handleFailedLogin(c *gin.Context, email, clientIP string) {
+	if locked := recordFailedLogin(email, clientIP); locked > 0 {
+		respondLoginLocked(c, locked)
+		return
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+}
+
+// recordFailedLogin counts a wrong password or second factor against the account and IP
+// and returns how long they are now locked out, if at all
+func recordFailedLogin(email, clientIP string) time.Duration {
+	lockouts, err := authUtils.RecordLoginFailure(email, clientIP)
+	if err != nil {
+		log.Println("Error recording login failure:", err)
+	}
+
+	if len(lockouts) == 0 {
+		return 0
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var longest time.Duration
+	for _, lockout := range lockouts {
+		log.Printf("Login lockout: %s %s locked for %s after %d failed attempts (ip %s)",
+			lockout.Scope, lockout.Subject, lockout.Duration, lockout.Failures, clientIP)
+
+		record := models.LoginLockout{
+			ID:          primitive.NewObjectID(),
+			Scope:       lockout.Scope,
+			Subject:     lockout.Subject,
+			IP:          clientIP,
+			Failures:    lockout.Failures,
+			LockedUntil: time.Now().Add(lockout.Duration),
+			CreatedAt:   time.Now(),
+		}
+		if _, err := config.GetCollection("login_lockouts").InsertOne(ctx, record); err != nil {
+			log.Println("Error recording login lockout:", err)
+		}
+
+		if lockout.Duration > longest {
+			longest = lockout.Duration
+		}
+	}
+
+	return longest
+}
+
+// respondEmailTaken reports that another account already uses the email address
+func respondEmailTaken(c *gin.Context) {
+	c.JSON(http.StatusConflict, gin.H{"error": "User with this email already exists"})
+}
+
+// respondLoginLocked tells the client how long to wait before trying to log in again
+func respondLoginLocked(c *gin.Context, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Too many failed login attempts, please try again later",
+		"retry_after": seconds,
 	})
 }
 
@@ -161,20 +274,306 @@ func GetMe(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"id":        user.ID,
-		"name":      user.Name,
-		"email":     user.Email,
-		"createdAt": user.CreatedAt,
+		"id":                  user.ID,
+		"name":                user.Name,
+		"email":               user.Email,
+		"verified":            user.Verified,
+		"role":                user.Role,
+		"avatarUrl":           user.AvatarURL,
+		"reportAnonymously":   user.ReportAnonymously,
+		"twoFactorEnabled":    user.TwoFactorEnabled,
+		"twoFactorRequired":   user.TwoFactorRequired,
+		"deletionScheduledAt": user.DeletionScheduledAt,
+		"createdAt":           user.CreatedAt,
 	})
 }
 
-// LogoutUser handles user logout by clearing the auth_token cookie
+// VerifyEmail marks the user's account as verified using the token from the verification email
+func VerifyEmail(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	subject, err := authUtils.ConsumeOneTimeToken(authUtils.PurposeVerifyEmail, input.Token)
+	if err != nil {
+		if errors.Is(err, authUtils.ErrOneTimeTokenInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link"})
+			return
+		}
+		log.Println("Error consuming verification token:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(subject.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link"})
+		return
+	}
+
+	userCollection := config.GetCollection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Matching on the email too ignores links sent to an address the user has since changed
+	result, err := userCollection.UpdateOne(ctx,
+		bson.M{"_id": objectID, "email": models.NormalizeEmail(subject.Email)},
+		bson.M{"$set": bson.M{"verified": true, "updatedAt": time.Now()}},
+	)
+	if err != nil {
+		log.Println("Error verifying user:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// ResendVerificationEmail sends a fresh verification link to the authenticated user
+func ResendVerificationEmail(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	userCollection := config.GetCollection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.Verified {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email is already verified"})
+		return
+	}
+
+	if err := sendVerificationEmail(user); err != nil {
+		log.Println("Error sending verification email:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
+
+// RefreshToken rotates the refresh token and issues a new access token.
+// Cookie clients get new cookies; clients that send the refresh token in the body get the new pair in the body.
+func RefreshToken(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	_ = c.ShouldBindJSON(&input)
+
+	refreshToken, inBody := input.RefreshToken, input.RefreshToken != ""
+	if !inBody {
+		refreshToken, _ = c.Cookie("refresh_token")
+	}
+	if refreshToken == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No refresh token provided"})
+		return
+	}
+
+	userID, sessionID, newRefreshToken, err := authUtils.RotateRefreshToken(refreshToken)
+	if err != nil {
+		if errors.Is(err, authUtils.ErrRefreshTokenInvalid) || errors.Is(err, authUtils.ErrRefreshTokenReused) {
+			clearAuthCookies(c)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		log.Println("Error rotating refresh token:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	// Load the user so role changes take effect on the next refresh
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		clearAuthCookies(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	userCollection := config.GetCollection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&user); err != nil {
+		clearAuthCookies(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	accessToken, err := authUtils.GenerateAndSetToken(userID, sessionID, user.Role)
+	if err != nil {
+		log.Println("Error generating token:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+	tokens := &authTokens{AccessToken: accessToken, RefreshToken: newRefreshToken}
+
+	response := gin.H{
+		"message": "Token refreshed successfully",
+	}
+	if inBody {
+		addTokensToResponse(response, tokens)
+	} else {
+		setAuthCookies(c, tokens)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// LogoutUser revokes the current session and its tokens and clears the auth cookies
 func LogoutUser(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	_ = c.ShouldBindJSON(&input)
+
+	if accessToken, _ := authUtils.AccessTokenFromRequest(c.Request); accessToken != "" {
+		if claims, err := authUtils.ParseAccessToken(accessToken); err == nil {
+			if err := authUtils.RevokeAccessToken(claims.ID, claims.ExpiresAt.Time); err != nil {
+				log.Println("Error revoking access token:", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+				return
+			}
+			if err := authUtils.RevokeSession(claims.UserID, claims.SessionID); err != nil && !errors.Is(err, authUtils.ErrSessionNotFound) {
+				log.Println("Error revoking session:", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+				return
+			}
+		}
+	}
+
+	refreshToken := input.RefreshToken
+	if refreshToken == "" {
+		refreshToken, _ = c.Cookie("refresh_token")
+	}
+	if refreshToken != "" {
+		if err := authUtils.RevokeRefreshToken(refreshToken); err != nil {
+			log.Println("Error revoking refresh token:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+			return
+		}
+	}
+
+	clearAuthCookies(c)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Logged out successfully",
+	})
+}
+
+// authTokens is the access and refresh token pair of a session
+type authTokens struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+// issueAuthTokens starts a new session for the user and returns its tokens
+func issueAuthTokens(c *gin.Context, user models.User, device string) (*authTokens, error) {
+	userID := user.ID.Hex()
+	userAgent := c.Request.UserAgent()
+	if device == "" {
+		device = describeDevice(userAgent)
+	}
+
+	session, err := authUtils.CreateSession(userID, device, c.ClientIP(), userAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := authUtils.GenerateAndSetToken(userID, session.ID, user.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := authUtils.IssueRefreshToken(userID, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &authTokens{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+// addTokensToResponse puts the tokens in the response body for clients using Bearer authentication
+func addTokensToResponse(response gin.H, tokens *authTokens) {
+	response["accessToken"] = tokens.AccessToken
+	response["refreshToken"] = tokens.RefreshToken
+	response["tokenType"] = "Bearer"
+	response["expiresIn"] = int(authUtils.AccessTokenTTL.Seconds())
+}
+
+// setAuthCookies writes the access token cookie and the refresh token cookie scoped to /api/auth
+func setAuthCookies(c *gin.Context, tokens *authTokens) {
 	environment := os.Getenv("GO_ENV")
 	domain := os.Getenv("DOMAIN")
 
+	// For production, don't set domain to allow cross-origin cookies
+	if environment == "production" {
+		domain = ""
+	}
+
+	authUtils.SetAccessTokenCookie(c.Writer, tokens.AccessToken)
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     "refresh_token",
+		Value:    tokens.RefreshToken,
+		MaxAge:   int(authUtils.RefreshTokenTTL.Seconds()),
+		Path:     "/api/auth", // only sent to refresh and logout
+		Domain:   domain,
+		Secure:   environment == "production",
+		HttpOnly: true,
+		SameSite: http.SameSiteNoneMode,
+	})
+}
+
+// clearAuthCookies expires both auth cookies
+func clearAuthCookies(c *gin.Context) {
+	environment := os.Getenv("GO_ENV")
+	domain := os.Getenv("DOMAIN")
+
+	if environment == "production" {
+		domain = ""
+	}
+
 	c.SetCookie("auth_token", "", -1, "/", domain, environment == "production", true)
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Logged out successfully",
+	c.SetCookie("refresh_token", "", -1, "/api/auth", domain, environment == "production", true)
+}
+
+// sendVerificationEmail mails the user a one-time link that verifies their address
+func sendVerificationEmail(user models.User) error {
+	token, err := authUtils.IssueOneTimeToken(authUtils.PurposeVerifyEmail, authUtils.OneTimeToken{UserID: user.ID.Hex(), Email: user.Email}, 24*time.Hour)
+	if err != nil {
+		return err
+	}
+
+	link := os.Getenv("CLIENT_URL") + "/verify-email?token=" + url.QueryEscape(token)
+	return mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your CivicSync account",
+		Body: "Hi " + user.Name + ",\n\n" +
+			"Please confirm your email address by opening the link below. It expires in 24 hours.\n\n" +
+			link + "\n\n" +
+			"If you did not create a CivicSync account, you can ignore this email.\n",
 	})
 }
@@ -0,0 +1,365 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"civicsync-be/config"
+	"civicsync-be/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var commentCollection *mongo.Collection = config.GetCollection("comments")
+
+// CreateComment adds a comment to an issue, or a reply when parentId is given
+func CreateComment(c *gin.Context) {
+	issueID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid issue ID"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	authorID, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var input struct {
+		Body     string  `json:"body" binding:"required,max=2000"`
+		ParentID *string `json:"parentId,omitempty"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	body := strings.TrimSpace(input.Body)
+	if body == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Comment cannot be empty"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	count, err := issueCollection.CountDocuments(ctx, bson.M{"_id": issueID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve issue"})
+		return
+	}
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Issue not found"})
+		return
+	}
+
+	comment := models.Comment{
+		ID:        primitive.NewObjectID(),
+		Issue:     issueID,
+		Author:    authorID,
+		Body:      body,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	if input.ParentID != nil {
+		parentID, err := primitive.ObjectIDFromHex(*input.ParentID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid parent comment ID"})
+			return
+		}
+
+		// Replies to deleted comments are allowed so a thread can carry on
+		count, err := commentCollection.CountDocuments(ctx, bson.M{"_id": parentID, "issue": issueID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve parent comment"})
+			return
+		}
+		if count == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parent comment not found on this issue"})
+			return
+		}
+		comment.Parent = &parentID
+	}
+
+	if _, err := commentCollection.InsertOne(ctx, comment); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create comment"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, comment)
+}
+
+// GetComments lists the top-level comments of an issue, or the replies to one comment when ?parent= is given, oldest first
+func GetComments(c *gin.Context) {
+	issueID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid issue ID"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	filter := bson.M{"issue": issueID, "parent": bson.M{"$exists": false}}
+	if parent := c.Query("parent"); parent != "" {
+		parentID, err := primitive.ObjectIDFromHex(parent)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid parent comment ID"})
+			return
+		}
+		filter["parent"] = parentID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	totalCount, err := commentCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count comments"})
+		return
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: 1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+
+	cursor, err := commentCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve comments"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var comments []models.Comment
+	if err := cursor.All(ctx, &comments); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode comments"})
+		return
+	}
+
+	type CommentWithAuthor struct {
+		models.Comment
+		Author  *models.PublicUser `json:"author"`
+		Replies int64              `json:"replies"`
+	}
+
+	commentIDs := make([]primitive.ObjectID, 0, len(comments))
+	authorIDs := make([]primitive.ObjectID, 0, len(comments))
+	for _, comment := range comments {
+		commentIDs = append(commentIDs, comment.ID)
+		if !comment.Deleted {
+			authorIDs = append(authorIDs, comment.Author)
+		}
+	}
+	replies := replyCounts(ctx, commentIDs)
+	authors := newCreatorLookup(c)
+	authors.prefetch(ctx, authorIDs)
+
+	response := make([]CommentWithAuthor, 0, len(comments))
+	for _, comment := range comments {
+		entry := CommentWithAuthor{Comment: comment, Replies: replies[comment.ID]}
+		if !comment.Deleted {
+			author := authors.creator(ctx, comment.Author)
+			entry.Author = &author
+		}
+		response = append(response, entry)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"comments":      response,
+		"totalComments": totalCount,
+		"totalPages":    int((totalCount + int64(limit) - 1) / int64(limit)),
+		"currentPage":   page,
+	})
+}
+
+// UpdateComment lets the author edit the body of their comment
+func UpdateComment(c *gin.Context) {
+	comment, userObjID, ok := findIssueComment(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Body string `json:"body" binding:"required,max=2000"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	body := strings.TrimSpace(input.Body)
+	if body == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Comment cannot be empty"})
+		return
+	}
+
+	if comment.Author != userObjID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only edit your own comments"})
+		return
+	}
+	if comment.Deleted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Deleted comments cannot be edited"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	_, err := commentCollection.UpdateOne(ctx, bson.M{"_id": comment.ID}, bson.M{"$set": bson.M{
+		"body":      body,
+		"editedAt":  now,
+		"updatedAt": now,
+	}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+		return
+	}
+
+	comment.Body = body
+	comment.EditedAt = &now
+	comment.UpdatedAt = now
+	c.JSON(http.StatusOK, comment)
+}
+
+// DeleteComment soft-deletes a comment; the author or a moderator may delete it and its replies stay visible
+func DeleteComment(c *gin.Context) {
+	comment, userObjID, ok := findIssueComment(c)
+	if !ok {
+		return
+	}
+
+	if comment.Author != userObjID && !currentUserRole(c).CanModerateIssues() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to delete this comment"})
+		return
+	}
+	if comment.Deleted {
+		c.JSON(http.StatusOK, gin.H{"message": "Comment deleted successfully"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	_, err := commentCollection.UpdateOne(ctx, bson.M{"_id": comment.ID}, bson.M{"$set": bson.M{
+		"body":      "",
+		"deleted":   true,
+		"deletedAt": now,
+		"updatedAt": now,
+	}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Comment deleted successfully"})
+}
+
+// findIssueComment loads the comment named in the URL together with the authenticated user's ID
+func findIssueComment(c *gin.Context) (*models.Comment, primitive.ObjectID, bool) {
+	issueID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid issue ID"})
+		return nil, primitive.NilObjectID, false
+	}
+
+	commentID, err := primitive.ObjectIDFromHex(c.Param("commentId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid comment ID"})
+		return nil, primitive.NilObjectID, false
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, primitive.NilObjectID, false
+	}
+
+	userObjID, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, primitive.NilObjectID, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var comment models.Comment
+	err = commentCollection.FindOne(ctx, bson.M{"_id": commentID, "issue": issueID}).Decode(&comment)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve comment"})
+		}
+		return nil, primitive.NilObjectID, false
+	}
+
+	return &comment, userObjID, true
+}
+
+// countComments returns how many visible comments an issue has
+func countComments(ctx context.Context, issueID primitive.ObjectID) int64 {
+	return commentCounts(ctx, []primitive.ObjectID{issueID})[issueID]
+}
+
+// commentCounts returns how many visible comments each of the issues has, in one query
+func commentCounts(ctx context.Context, issueIDs []primitive.ObjectID) map[primitive.ObjectID]int64 {
+	return countCommentsBy(ctx, "issue", bson.M{"issue": bson.M{"$in": issueIDs}, "deleted": bson.M{"$ne": true}})
+}
+
+// replyCounts returns how many replies each of the comments has, in one query
+func replyCounts(ctx context.Context, commentIDs []primitive.ObjectID) map[primitive.ObjectID]int64 {
+	return countCommentsBy(ctx, "parent", bson.M{"parent": bson.M{"$in": commentIDs}})
+}
+
+// countCommentsBy counts the comments matching filter, grouped by the given field
+func countCommentsBy(ctx context.Context, field string, filter bson.M) map[primitive.ObjectID]int64 {
+	counts := make(map[primitive.ObjectID]int64)
+
+	cursor, err := commentCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{"_id": "$" + field, "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return counts
+	}
+
+	var results []struct {
+		ID    primitive.ObjectID `bson:"_id"`
+		Count int64              `bson:"count"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return counts
+	}
+	for _, result := range results {
+		counts[result.ID] = result.Count
+	}
+	return counts
+}
@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	authUtils "civicsync-be/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetCSRFToken returns the CSRF token the SPA sends in the X-CSRF-Token header, setting the matching cookie.
+// The token is in the body because a SPA on another origin cannot read our cookies.
+func GetCSRFToken(c *gin.Context) {
+	token, err := c.Cookie(authUtils.CSRFCookieName)
+	if err != nil || token == "" {
+		token, err = authUtils.GenerateCSRFToken()
+		if err != nil {
+			log.Println("Error generating CSRF token:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+			return
+		}
+	}
+
+	environment := os.Getenv("GO_ENV")
+	domain := os.Getenv("DOMAIN")
+
+	if environment == "production" {
+		domain = ""
+	}
+
+	// Refreshed on every call so it lives as long as the session that uses it
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     authUtils.CSRFCookieName,
+		Value:    token,
+		MaxAge:   int(authUtils.RefreshTokenTTL.Seconds()),
+		Path:     "/",
+		Domain:   domain,
+		Secure:   environment == "production",
+		HttpOnly: true,
+		SameSite: http.SameSiteNoneMode,
+	})
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"csrfToken": token})
+}
@@ -0,0 +1,475 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"civicsync-be/config"
+	"civicsync-be/mailer"
+	"civicsync-be/models"
+	authUtils "civicsync-be/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// Accounts with more issues and votes than this get their export generated in the background
+	syncExportLimit = 500
+	exportLinkTTL   = 24 * time.Hour
+	// Background exports wait here for a worker; requests beyond that are turned away
+	exportQueueSize = 100
+)
+
+var exportCollection *mongo.Collection = config.GetCollection("data_exports")
+
+var exportQueue = make(chan models.DataExport, exportQueueSize)
+
+// RequestDataExport returns a ZIP of everything stored about the authenticated user.
+// Small accounts get the archive directly; large ones get a 202 and an email once the archive is ready.
+func RequestDataExport(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userObjID, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	issueCount, err := issueCollection.CountDocuments(ctx, bson.M{"createdBy": userObjID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prepare export"})
+		return
+	}
+	voteCount, err := voteCollection.CountDocuments(ctx, bson.M{"user": userObjID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prepare export"})
+		return
+	}
+
+	if issueCount+voteCount <= syncExportLimit {
+		var buf bytes.Buffer
+		if err := writeDataExport(ctx, userObjID, &buf); err != nil {
+			log.Println("Error building data export:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build export"})
+			return
+		}
+
+		c.Header("Content-Disposition", `attachment; filename="civicsync-export.zip"`)
+		c.Data(http.StatusOK, "application/zip", buf.Bytes())
+		return
+	}
+
+	// One background export per user at a time keeps a single account from filling the queue
+	var pending models.DataExport
+	err = exportCollection.FindOne(ctx, bson.M{"user": userObjID, "status": models.ExportPending}).Decode(&pending)
+	if err == nil {
+		c.JSON(http.StatusAccepted, pending)
+		return
+	}
+	if err != mongo.ErrNoDocuments {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prepare export"})
+		return
+	}
+
+	export := models.DataExport{
+		ID:        primitive.NewObjectID(),
+		User:      userObjID,
+		Status:    models.ExportPending,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if _, err := exportCollection.InsertOne(ctx, export); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prepare export"})
+		return
+	}
+
+	select {
+	case exportQueue <- export:
+	default:
+		exportCollection.DeleteOne(ctx, bson.M{"_id": export.ID})
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Too many exports are being generated, please try again later"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, export)
+}
+
+// GetDataExport returns the status of a background export
+func GetDataExport(c *gin.Context) {
+	export, ok := findOwnDataExport(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, export)
+}
+
+// DownloadDataExport streams a finished background export until its link expires
+func DownloadDataExport(c *gin.Context) {
+	export, ok := findOwnDataExport(c)
+	if !ok {
+		return
+	}
+
+	switch {
+	case export.Status == models.ExportPending:
+		c.JSON(http.StatusConflict, gin.H{"error": "Export is still being generated"})
+		return
+	case export.Status == models.ExportFailed:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Export failed, please request a new one"})
+		return
+	case export.ExpiresAt == nil || time.Now().After(*export.ExpiresAt):
+		c.JSON(http.StatusGone, gin.H{"error": "Export has expired, please request a new one"})
+		return
+	}
+
+	c.FileAttachment(export.FilePath, "civicsync-export.zip")
+}
+
+// findOwnDataExport loads the export named in the URL if it belongs to the authenticated user
+func findOwnDataExport(c *gin.Context) (*models.DataExport, bool) {
+	exportID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export ID"})
+		return nil, false
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, false
+	}
+
+	userObjID, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var export models.DataExport
+	err = exportCollection.FindOne(ctx, bson.M{"_id": exportID, "user": userObjID}).Decode(&export)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve export"})
+		}
+		return nil, false
+	}
+
+	return &export, true
+}
+
+// generateDataExport writes the archive for a background export to EXPORT_DIR and emails the user
+func generateDataExport(export models.DataExport) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	update := bson.M{"updatedAt": time.Now()}
+	filePath, err := writeDataExportFile(ctx, export)
+	if err != nil {
+		log.Printf("Error generating data export %s: %v", export.ID.Hex(), err)
+		update["status"] = models.ExportFailed
+	} else {
+		update["status"] = models.ExportReady
+		update["filePath"] = filePath
+		update["expiresAt"] = time.Now().Add(exportLinkTTL)
+	}
+
+	if _, err := exportCollection.UpdateOne(ctx, bson.M{"_id": export.ID}, bson.M{"$set": update}); err != nil {
+		log.Printf("Error updating data export %s: %v", export.ID.Hex(), err)
+		return
+	}
+	if update["status"] != models.ExportReady {
+		return
+	}
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"_id": export.User}).Decode(&user); err != nil {
+		log.Printf("Error loading user for data export %s: %v", export.ID.Hex(), err)
+		return
+	}
+
+	link := os.Getenv("CLIENT_URL") + "/account/exports/" + export.ID.Hex()
+	err = mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your CivicSync data export is ready",
+		Body: "Hi " + user.Name + ",\n\n" +
+			"The copy of your CivicSync data you asked for is ready. Sign in and open the link below to download it. The link expires in 24 hours.\n\n" +
+			link + "\n",
+	})
+	if err != nil {
+		log.Println("Error sending data export email:", err)
+	}
+}
+
+func writeDataExportFile(ctx context.Context, export models.DataExport) (string, error) {
+	dir := os.Getenv("EXPORT_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "civicsync-exports")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+
+	filePath := filepath.Join(dir, export.ID.Hex()+".zip")
+	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return "", err
+	}
+
+	if err := writeDataExport(ctx, export.User, f); err != nil {
+		f.Close()
+		os.Remove(filePath)
+		return "", err
+	}
+
+	return filePath, f.Close()
+}
+
+// writeDataExport writes a ZIP with one JSON file per kind of personal data
+func writeDataExport(ctx context.Context, userID primitive.ObjectID, w io.Writer) error {
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		return err
+	}
+
+	var issues []models.Issue
+	cursor, err := issueCollection.Find(ctx, bson.M{"createdBy": userID})
+	if err != nil {
+		return err
+	}
+	if err := cursor.All(ctx, &issues); err != nil {
+		return err
+	}
+
+	// Status changes of the user's issues, and the ones the user made as an official
+	issueIDs := make([]primitive.ObjectID, 0, len(issues))
+	for _, issue := range issues {
+		issueIDs = append(issueIDs, issue.ID)
+	}
+	var timeline []models.IssueStatusChange
+	cursor, err = timelineCollection.Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"issue": bson.M{"$in": issueIDs}},
+		bson.M{"actor": userID},
+	}}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	if err := cursor.All(ctx, &timeline); err != nil {
+		return err
+	}
+
+	var comments []models.Comment
+	cursor, err = commentCollection.Find(ctx, bson.M{"author": userID}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	if err := cursor.All(ctx, &comments); err != nil {
+		return err
+	}
+
+	var votes []models.Vote
+	cursor, err = voteCollection.Find(ctx, bson.M{"user": userID})
+	if err != nil {
+		return err
+	}
+	if err := cursor.All(ctx, &votes); err != nil {
+		return err
+	}
+
+	var apiKeys []models.APIKey
+	cursor, err = apiKeyCollection.Find(ctx, bson.M{"user": userID})
+	if err != nil {
+		return err
+	}
+	if err := cursor.All(ctx, &apiKeys); err != nil {
+		return err
+	}
+
+	sessions, err := authUtils.ListSessions(userID.Hex())
+	if err != nil {
+		return err
+	}
+
+	// Photos with the metadata kept about them, including a GPS location not yet dropped
+	var ownAssets []models.Asset
+	cursor, err = assetCollection.Find(ctx, bson.M{"owner": userID}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	if err := cursor.All(ctx, &ownAssets); err != nil {
+		return err
+	}
+	assets := make([]exportedAsset, 0, len(ownAssets))
+	for _, asset := range ownAssets {
+		assets = append(assets, exportedAsset{Asset: asset, Location: asset.Location})
+	}
+
+	lockouts, err := userLoginLockouts(ctx, user.Email, sessions)
+	if err != nil {
+		return err
+	}
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", user},
+		{"issues.json", issues},
+		{"issue_timeline.json", timeline},
+		{"comments.json", comments},
+		{"votes.json", votes},
+		{"sessions.json", sessions},
+		{"login_lockouts.json", lockouts},
+		{"assets.json", assets},
+		{"api_keys.json", apiKeys},
+	}
+
+	archive := zip.NewWriter(w)
+	for _, file := range files {
+		entry, err := archive.Create(file.name)
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(entry)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// exportedAsset is an uploaded photo as it appears in a data export, with the fields API responses hide
+type exportedAsset struct {
+	models.Asset
+	Location *models.PhotoLocation `json:"location,omitempty"`
+}
+
+// userLoginLockouts returns the lockouts of the user's account and of the IP addresses it was used from,
+// as seen in its own lockouts and its sessions
+func userLoginLockouts(ctx context.Context, email string, sessions []models.Session) ([]models.LoginLockout, error) {
+	lockoutCollection := config.GetCollection("login_lockouts")
+
+	var lockouts []models.LoginLockout
+	cursor, err := lockoutCollection.Find(ctx, bson.M{"scope": authUtils.LockScopeAccount, "subject": email})
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &lockouts); err != nil {
+		return nil, err
+	}
+
+	ips := make([]string, 0, len(lockouts)+len(sessions))
+	for _, lockout := range lockouts {
+		ips = append(ips, lockout.IP)
+	}
+	for _, session := range sessions {
+		if session.IP != "" {
+			ips = append(ips, session.IP)
+		}
+	}
+
+	var ipLockouts []models.LoginLockout
+	cursor, err = lockoutCollection.Find(ctx, bson.M{"scope": authUtils.LockScopeIP, "subject": bson.M{"$in": ips}})
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &ipLockouts); err != nil {
+		return nil, err
+	}
+
+	return append(lockouts, ipLockouts...), nil
+}
+
+// RunDataExportWorkers generates background exports with a fixed number of workers.
+// Exports left pending by a restart are queued again.
+func RunDataExportWorkers(workers int) {
+	for i := 0; i < workers; i++ {
+		go func() {
+			for export := range exportQueue {
+				generateDataExport(export)
+			}
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	cursor, err := exportCollection.Find(ctx, bson.M{"status": models.ExportPending})
+	if err != nil {
+		log.Println("Error finding pending exports:", err)
+		return
+	}
+
+	var pending []models.DataExport
+	if err := cursor.All(ctx, &pending); err != nil {
+		log.Println("Error decoding pending exports:", err)
+		return
+	}
+	for _, export := range pending {
+		exportQueue <- export
+	}
+}
+
+// RunExportCleanup periodically deletes expired and failed exports along with their archives
+func RunExportCleanup(interval time.Duration) {
+	for {
+		purgeExports()
+		time.Sleep(interval)
+	}
+}
+
+func purgeExports() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	cursor, err := exportCollection.Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"expiresAt": bson.M{"$lt": time.Now()}},
+		bson.M{"status": models.ExportFailed, "updatedAt": bson.M{"$lt": time.Now().Add(-exportLinkTTL)}},
+	}})
+	if err != nil {
+		log.Println("Error finding expired exports:", err)
+		return
+	}
+
+	var expired []models.DataExport
+	if err := cursor.All(ctx, &expired); err != nil {
+		log.Println("Error decoding expired exports:", err)
+		return
+	}
+
+	for _, export := range expired {
+		if export.FilePath != "" {
+			if err := os.Remove(export.FilePath); err != nil && !os.IsNotExist(err) {
+				log.Printf("Error removing expired export %s: %v", export.ID.Hex(), err)
+				continue
+			}
+		}
+		exportCollection.DeleteOne(ctx, bson.M{"_id": export.ID})
+	}
+}
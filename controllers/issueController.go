@@ -2,9 +2,11 @@ package controllers
 
 import (
 	"context"
+	"log"
 	"net/http"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"civicsync-be/config"
@@ -20,6 +22,7 @@ import (
 var issueCollection *mongo.Collection = config.GetCollection("issues")
 var voteCollection *mongo.Collection = config.GetCollection("votes")
 var userCollection *mongo.Collection = config.GetCollection("users")
+var timelineCollection *mongo.Collection = config.GetCollection("issue_timeline")
 
 // CreateIssue handles the creation of a new issue
 func CreateIssue(c *gin.Context) {
@@ -38,14 +41,17 @@ func CreateIssue(c *gin.Context) {
 	}
 
 	var input struct {
-		Title       string   `json:"title" binding:"required,max=200"`
-		Description string   `json:"description" binding:"required,max=1000"`
-		Category    string   `json:"category" binding:"required"`
-		Location    string   `json:"location" binding:"required,max=200"`
-		ImageURL    *string  `json:"imageUrl,omitempty"`
-		Status      *string  `json:"status,omitempty"`
-		Latitude    *float64 `json:"latitude,omitempty"`
-		Longitude   *float64 `json:"longitude,omitempty"`
+		Title       string            `json:"title" binding:"required,max=200"`
+		Description string            `json:"description" binding:"required,max=1000"`
+		Category    string            `json:"category" binding:"required"`
+		Location    string            `json:"location" binding:"required,max=200"`
+		Attachments []attachmentInput `json:"attachments,omitempty" binding:"max=10,dive"`
+		Status      *string           `json:"status,omitempty"`
+		Latitude    *float64          `json:"latitude,omitempty"`
+		Longitude   *float64          `json:"longitude,omitempty"`
+		// UsePhotoLocation set to true places the issue where the first geotagged photo was taken,
+		// when no coordinates are given
+		UsePhotoLocation bool `json:"usePhotoLocation,omitempty"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -63,16 +69,16 @@ func CreateIssue(c *gin.Context) {
 		return
 	}
 
-	// Set default status if not provided
+	// Every issue starts as Pending; later statuses go through UpdateIssue, which enforces the allowed
+	// transitions, the required notes and the resolution photo
 	status := models.Pending
-	if input.Status != nil {
-		switch *input.Status {
-		case "Pending", "In Progress", "Resolved":
-			status = models.IssueStatus(*input.Status)
-		default:
+	if input.Status != nil && models.IssueStatus(*input.Status) != models.Pending {
+		if !models.IssueStatus(*input.Status).IsValid() {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
 			return
 		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "New issues start as Pending, change the status once the issue is created"})
+		return
 	}
 
 	// Create the issue
@@ -82,7 +88,6 @@ func CreateIssue(c *gin.Context) {
 		Description: input.Description,
 		Category:    models.IssueCategory(input.Category),
 		Location:    input.Location,
-		ImageURL:    input.ImageURL,
 		Status:      status,
 		CreatedBy:   createdByID,
 		Latitude:    input.Latitude,
@@ -94,8 +99,49 @@ func CreateIssue(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// Photos attached while reporting document the problem. Their locations are dropped from the assets
+	// whether or not the reporter uses one.
+	var photoLocation *models.PhotoLocation
+	for i, attachment := range input.Attachments {
+		assetID, location, err := attachPhoto(ctx, attachment.AssetID, createdByID, issue.ID)
+		if photoLocation == nil {
+			photoLocation = location
+		}
+		if err != nil {
+			detachAttachments(ctx, issue.Attachments)
+			respondPhotoError(c, err)
+			return
+		}
+		issue.Attachments = append(issue.Attachments, models.Attachment{
+			Asset:      assetID,
+			Kind:       models.AttachmentReport,
+			UploadedBy: createdByID,
+			Caption:    strings.TrimSpace(attachment.Caption),
+			Order:      i,
+			AddedAt:    issue.CreatedAt,
+		})
+	}
+
+	issue.PlaceAtPhoto(photoLocation, input.UsePhotoLocation)
+
 	_, err = issueCollection.InsertOne(ctx, issue)
 	if err != nil {
+		detachAttachments(ctx, issue.Attachments)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create issue"})
+		return
+	}
+
+	if err := recordStatusChange(ctx, &models.IssueStatusChange{
+		Issue: issue.ID,
+		Actor: createdByID,
+		To:    status,
+	}); err != nil {
+		log.Printf("Error recording status of new issue %s: %v", issue.ID.Hex(), err)
+		if _, err := issueCollection.DeleteOne(ctx, bson.M{"_id": issue.ID}); err != nil {
+			log.Printf("Error removing issue %s without a timeline: %v", issue.ID.Hex(), err)
+		} else {
+			detachAttachments(ctx, issue.Attachments)
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create issue"})
 		return
 	}
@@ -192,12 +238,22 @@ func GetAllIssues(c *gin.Context) {
 	// Enhance issues with vote counts and user vote status
 	type IssueWithVotes struct {
 		models.Issue
-		Votes        int64                  `json:"votes"`
-		UserHasVoted bool                   `json:"userHasVoted"`
-		CreatedBy    map[string]interface{} `json:"createdBy"`
+		Votes        int64             `json:"votes"`
+		Comments     int64             `json:"comments"`
+		UserHasVoted bool              `json:"userHasVoted"`
+		CreatedBy    models.PublicUser `json:"createdBy"`
 	}
 
 	issuesWithVotes := make([]IssueWithVotes, 0, len(issues))
+	issueIDs := make([]primitive.ObjectID, 0, len(issues))
+	creatorIDs := make([]primitive.ObjectID, 0, len(issues))
+	for _, issue := range issues {
+		issueIDs = append(issueIDs, issue.ID)
+		creatorIDs = append(creatorIDs, issue.CreatedBy)
+	}
+	comments := commentCounts(ctx, issueIDs)
+	creators := newCreatorLookup(c)
+	creators.prefetch(ctx, creatorIDs)
 
 	for _, issue := range issues {
 		// Count votes for this issue
@@ -219,21 +275,14 @@ func GetAllIssues(c *gin.Context) {
 		}
 
 		// Get creator info
-		var creator models.User
-		createdByMap := map[string]interface{}{
-			"id": issue.CreatedBy,
-		}
-
-		if err := userCollection.FindOne(ctx, bson.M{"_id": issue.CreatedBy}).Decode(&creator); err == nil {
-			createdByMap["name"] = creator.Name
-			createdByMap["email"] = creator.Email
-		}
+		createdBy := creators.creator(ctx, issue.CreatedBy)
 
 		issueWithVotes := IssueWithVotes{
 			Issue:        issue,
 			Votes:        voteCount,
+			Comments:     comments[issue.ID],
 			UserHasVoted: userHasVoted,
-			CreatedBy:    createdByMap,
+			CreatedBy:    createdBy,
 		}
 
 		issuesWithVotes = append(issuesWithVotes, issueWithVotes)
@@ -296,32 +345,28 @@ func GetIssue(c *gin.Context) {
 	}
 
 	// Get creator info
-	var creator models.User
-	createdByMap := map[string]interface{}{
-		"id": issue.CreatedBy,
-	}
-
-	if err := userCollection.FindOne(ctx, bson.M{"_id": issue.CreatedBy}).Decode(&creator); err == nil {
-		createdByMap["name"] = creator.Name
-		createdByMap["email"] = creator.Email
-	}
+	people := newCreatorLookup(c)
+	createdBy := people.creator(ctx, issue.CreatedBy)
 
 	// Create response with vote information
 	response := gin.H{
-		"id":           issue.ID,
-		"title":        issue.Title,
-		"description":  issue.Description,
-		"category":     issue.Category,
-		"location":     issue.Location,
-		"imageUrl":     issue.ImageURL,
-		"status":       issue.Status,
-		"createdBy":    createdByMap,
-		"latitude":     issue.Latitude,
-		"longitude":    issue.Longitude,
-		"createdAt":    issue.CreatedAt,
-		"updatedAt":    issue.UpdatedAt,
-		"votes":        voteCount,
-		"userHasVoted": userHasVoted,
+		"id":                issue.ID,
+		"title":             issue.Title,
+		"description":       issue.Description,
+		"category":          issue.Category,
+		"location":          issue.Location,
+		"imageUrl":          issue.ImageURL,
+		"attachments":       issueAttachments(ctx, issue, people),
+		"status":            issue.Status,
+		"createdBy":         createdBy,
+		"latitude":          issue.Latitude,
+		"longitude":         issue.Longitude,
+		"locationFromPhoto": issue.LocationFromPhoto,
+		"createdAt":         issue.CreatedAt,
+		"updatedAt":         issue.UpdatedAt,
+		"votes":             voteCount,
+		"comments":          countComments(ctx, issueID),
+		"userHasVoted":      userHasVoted,
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -366,12 +411,22 @@ func GetIssuesByUser(c *gin.Context) {
 	// Enhance issues with vote counts and user vote status
 	type IssueWithVotes struct {
 		models.Issue
-		Votes        int64                  `json:"votes"`
-		UserHasVoted bool                   `json:"userHasVoted"`
-		CreatedBy    map[string]interface{} `json:"createdBy"`
+		Votes        int64             `json:"votes"`
+		Comments     int64             `json:"comments"`
+		UserHasVoted bool              `json:"userHasVoted"`
+		CreatedBy    models.PublicUser `json:"createdBy"`
 	}
 
 	issuesWithVotes := make([]IssueWithVotes, 0, len(issues))
+	issueIDs := make([]primitive.ObjectID, 0, len(issues))
+	creatorIDs := make([]primitive.ObjectID, 0, len(issues))
+	for _, issue := range issues {
+		issueIDs = append(issueIDs, issue.ID)
+		creatorIDs = append(creatorIDs, issue.CreatedBy)
+	}
+	comments := commentCounts(ctx, issueIDs)
+	creators := newCreatorLookup(c)
+	creators.prefetch(ctx, creatorIDs)
 
 	for _, issue := range issues {
 		// Count votes for this issue
@@ -393,21 +448,14 @@ func GetIssuesByUser(c *gin.Context) {
 		}
 
 		// Get creator info
-		var creator models.User
-		createdByMap := map[string]interface{}{
-			"id": issue.CreatedBy,
-		}
-
-		if err := userCollection.FindOne(ctx, bson.M{"_id": issue.CreatedBy}).Decode(&creator); err == nil {
-			createdByMap["name"] = creator.Name
-			createdByMap["email"] = creator.Email
-		}
+		createdBy := creators.creator(ctx, issue.CreatedBy)
 
 		issueWithVotes := IssueWithVotes{
 			Issue:        issue,
 			Votes:        voteCount,
+			Comments:     comments[issue.ID],
 			UserHasVoted: userHasVoted,
-			CreatedBy:    createdByMap,
+			CreatedBy:    createdBy,
 		}
 
 		issuesWithVotes = append(issuesWithVotes, issueWithVotes)
@@ -416,7 +464,7 @@ func GetIssuesByUser(c *gin.Context) {
 	c.JSON(http.StatusOK, issuesWithVotes)
 }
 
-// UpdateIssue allows the creator of an issue to update its details
+// UpdateIssue lets the creator (or a moderator) edit an issue's content and officials change its status
 func UpdateIssue(c *gin.Context) {
 	idParam := c.Param("id")
 	issueID, err := primitive.ObjectIDFromHex(idParam)
@@ -440,14 +488,17 @@ func UpdateIssue(c *gin.Context) {
 	}
 
 	var input struct {
-		Title       *string  `json:"title,omitempty"`
-		Description *string  `json:"description,omitempty"`
-		Category    *string  `json:"category,omitempty"`
-		Location    *string  `json:"location,omitempty"`
-		ImageURL    *string  `json:"imageUrl,omitempty"`
-		Status      *string  `json:"status,omitempty"`
-		Latitude    *float64 `json:"latitude,omitempty"`
-		Longitude   *float64 `json:"longitude,omitempty"`
+		Title       *string `json:"title,omitempty"`
+		Description *string `json:"description,omitempty"`
+		Category    *string `json:"category,omitempty"`
+		Location    *string `json:"location,omitempty"`
+		Status      *string `json:"status,omitempty"`
+		// Note explains a status change and is stored on the issue timeline
+		Note      string   `json:"note,omitempty" binding:"max=1000"`
+		Latitude  *float64 `json:"latitude,omitempty"`
+		Longitude *float64 `json:"longitude,omitempty"`
+		// UsePhotoLocation set to false removes coordinates that were filled in from a photo
+		UsePhotoLocation *bool `json:"usePhotoLocation,omitempty"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -470,10 +521,23 @@ func UpdateIssue(c *gin.Context) {
 		return
 	}
 
-	if issue.CreatedBy != userObjID {
+	role := currentUserRole(c)
+	canEditContent := issue.CreatedBy == userObjID || role.CanModerateIssues()
+	editsContent := input.Title != nil || input.Description != nil || input.Category != nil ||
+		input.Location != nil || input.Latitude != nil || input.Longitude != nil || input.UsePhotoLocation != nil
+
+	if !canEditContent && !role.CanChangeIssueStatus() {
 		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to update this issue"})
 		return
 	}
+	if editsContent && !canEditContent {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the creator or a moderator can edit the details of this issue"})
+		return
+	}
+	if input.Status != nil && !role.CanChangeIssueStatus() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only officials can change the status of an issue"})
+		return
+	}
 
 	// Build update document
 	update := bson.M{"updatedAt": time.Now()}
@@ -497,17 +561,24 @@ func UpdateIssue(c *gin.Context) {
 	if input.Location != nil {
 		update["location"] = *input.Location
 	}
-	if input.ImageURL != nil {
-		update["imageUrl"] = input.ImageURL
-	}
-	if input.Status != nil {
-		switch *input.Status {
-		case "Pending", "In Progress", "Resolved":
-			update["status"] = *input.Status
-		default:
+	newStatus := issue.Status
+	if input.Status != nil && models.IssueStatus(*input.Status) != issue.Status {
+		newStatus = models.IssueStatus(*input.Status)
+		switch {
+		case !newStatus.IsValid():
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
 			return
+		case !issue.Status.CanTransitionTo(newStatus):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "An issue cannot move from " + string(issue.Status) + " to " + string(newStatus)})
+			return
+		case newStatus.RequiresNote() && strings.TrimSpace(input.Note) == "":
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A note is required when moving an issue to " + string(newStatus)})
+			return
+		case newStatus == models.Resolved && resolutionPhotoRequired() && !hasAttachmentKind(issue, models.AttachmentResolution):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Attach at least one resolution photo before resolving this issue"})
+			return
 		}
+		update["status"] = newStatus
 	}
 	if input.Latitude != nil {
 		update["latitude"] = *input.Latitude
@@ -516,17 +587,62 @@ func UpdateIssue(c *gin.Context) {
 		update["longitude"] = *input.Longitude
 	}
 
-	// Update the issue in the database
-	_, err = issueCollection.UpdateOne(ctx, bson.M{"_id": issueID}, bson.M{"$set": update})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update issue"})
+	unset := bson.M{}
+	if input.Latitude != nil || input.Longitude != nil {
+		// Coordinates given by the reporter replace the ones from the photo
+		unset["locationFromPhoto"] = ""
+	} else if input.UsePhotoLocation != nil && !*input.UsePhotoLocation && issue.LocationFromPhoto {
+		unset["latitude"] = ""
+		unset["longitude"] = ""
+		unset["locationFromPhoto"] = ""
+	}
+
+	updateDoc := bson.M{"$set": update}
+	if len(unset) > 0 {
+		updateDoc["$unset"] = unset
+	}
+
+	// Matching on the old status stops two concurrent status changes from both being applied
+	filter := bson.M{"_id": issueID, "status": issue.Status}
+	if newStatus != issue.Status && newStatus == models.Resolved && resolutionPhotoRequired() {
+		// Also keeps the last resolution photo from being removed while the issue is being resolved
+		filter["attachments.kind"] = models.AttachmentResolution
+	}
+
+	// The timeline entry is written first and removed again if the update does not go through
+	var change *models.IssueStatusChange
+	if newStatus != issue.Status {
+		change = &models.IssueStatusChange{
+			Issue: issueID,
+			Actor: userObjID,
+			From:  issue.Status,
+			To:    newStatus,
+			Note:  strings.TrimSpace(input.Note),
+		}
+		if err := recordStatusChange(ctx, change); err != nil {
+			log.Printf("Error recording status change of issue %s: %v", issueID.Hex(), err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update issue"})
+			return
+		}
+	}
+
+	result, err := issueCollection.UpdateOne(ctx, filter, updateDoc)
+	if err != nil || result.MatchedCount == 0 {
+		if change != nil {
+			forgetStatusChange(ctx, change)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update issue"})
+		} else {
+			c.JSON(http.StatusConflict, gin.H{"error": "The issue changed in the meantime, please reload it"})
+		}
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Issue updated successfully"})
 }
 
-// DeleteIssue allows the creator of an issue to delete it
+// DeleteIssue allows the creator of an issue or a moderator to delete it
 func DeleteIssue(c *gin.Context) {
 	idParam := c.Param("id")
 	issueID, err := primitive.ObjectIDFromHex(idParam)
@@ -564,7 +680,7 @@ func DeleteIssue(c *gin.Context) {
 		return
 	}
 
-	if issue.CreatedBy != userObjID {
+	if issue.CreatedBy != userObjID && !currentUserRole(c).CanModerateIssues() {
 		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to delete this issue"})
 		return
 	}
@@ -576,8 +692,13 @@ func DeleteIssue(c *gin.Context) {
 		return
 	}
 
-	// Delete associated votes
+	// Delete associated votes, timeline, comments and photos
 	_, _ = voteCollection.DeleteMany(ctx, bson.M{"issue": issueID})
+	_, _ = timelineCollection.DeleteMany(ctx, bson.M{"issue": issueID})
+	_, _ = commentCollection.DeleteMany(ctx, bson.M{"issue": issueID})
+	if err := deleteAssets(ctx, bson.M{"issue": issueID}); err != nil {
+		log.Printf("Error deleting photos of issue %s: %v", issueID.Hex(), err)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Issue deleted successfully"})
 }
@@ -808,7 +929,7 @@ func GetIssueAnalytics(c *gin.Context) {
 	}
 
 	openIssues, err := issueCollection.CountDocuments(ctx, bson.M{
-		"status": bson.M{"$in": []string{"Pending", "In Progress"}},
+		"status": bson.M{"$in": models.OpenIssueStatuses()},
 	})
 	if err != nil {
 		openIssues = 0
@@ -905,3 +1026,13 @@ func RecentIssues(c *gin.Context) {
 
 	c.JSON(http.StatusOK, response)
 }
+
+// currentUserRole returns the role set by the auth middleware, defaulting to citizen
+func currentUserRole(c *gin.Context) models.Role {
+	if roleVal, exists := c.Get("user_role"); exists {
+		if role, ok := roleVal.(models.Role); ok {
+			return role
+		}
+	}
+	return models.RoleCitizen
+}
@@ -0,0 +1,24 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+
+	authUtils "civicsync-be/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetJWKS publishes the public keys other services use to verify our tokens
+func GetJWKS(c *gin.Context) {
+	jwks, err := authUtils.JWKS()
+	if err != nil {
+		log.Println("Error building JWKS:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	// Short caching lets verifiers pick up rotated keys quickly
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, jwks)
+}
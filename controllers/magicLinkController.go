@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"civicsync-be/mailer"
+	"civicsync-be/models"
+	authUtils "civicsync-be/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const magicLinkTTL = 15 * time.Minute
+
+// RequestMagicLink emails a single-use sign-in link to accounts that opted in to passwordless login. The response
+// is identical whether or not the email is registered or has opted in.
+func RequestMagicLink(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.Email = models.NormalizeEmail(input.Email)
+
+	retryAfter, err := authUtils.AllowMagicLinkRequest(input.Email)
+	if err != nil {
+		log.Println("Error checking magic link rate limit:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+	if retryAfter > 0 {
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Too many sign-in links requested for this email, please try again later",
+			"retry_after": seconds,
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Only accounts that opted in to passwordless login can be entered with a link
+	var user models.User
+	filter := bson.M{"email": input.Email, "passwordlessLogin": true, "deleted": bson.M{"$ne": true}}
+	if err := userCollection.FindOne(ctx, filter).Decode(&user); err == nil {
+		// Sending in the background keeps response times the same for unknown addresses
+		go func() {
+			if err := sendMagicLinkEmail(user); err != nil {
+				log.Println("Error sending magic link email:", err)
+			}
+		}()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "If an account exists for this email, a sign-in link has been sent",
+	})
+}
+
+// ConsumeMagicLink signs the user in with the token from a magic link email
+func ConsumeMagicLink(c *gin.Context) {
+	var input struct {
+		Token        string `json:"token" binding:"required"`
+		Device       string `json:"device,omitempty" binding:"max=100"`
+		ReturnTokens bool   `json:"returnTokens,omitempty"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	subject, err := authUtils.ConsumeOneTimeToken(authUtils.PurposeMagicLink, input.Token)
+	if err != nil {
+		if errors.Is(err, authUtils.ErrOneTimeTokenInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired sign-in link"})
+			return
+		}
+		log.Println("Error consuming magic link token:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(subject.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired sign-in link"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The user may have turned passwordless login off since the link was sent
+	var user models.User
+	filter := bson.M{"_id": objectID, "passwordlessLogin": true, "deleted": bson.M{"$ne": true}}
+	if err := userCollection.FindOne(ctx, filter).Decode(&user); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired sign-in link"})
+		return
+	}
+
+	// The link was delivered to the account's address, which also proves ownership of it. Whoever
+	// registered the address before it was verified may have set the password, so it no longer counts
+	// and their sessions end, as when an unverified account is linked to an OpenID Connect identity.
+	if !user.Verified {
+		_, err := userCollection.UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{
+			"$set":   bson.M{"verified": true, "updatedAt": time.Now()},
+			"$unset": bson.M{"password": ""},
+		})
+		if err != nil {
+			log.Println("Error verifying user:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+			return
+		}
+		if err := authUtils.RevokeAllSessions(user.ID.Hex()); err != nil {
+			log.Println("Error revoking sessions after magic link verification:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+			return
+		}
+		user.Verified = true
+		user.Password = ""
+	}
+
+	completeLogin(c, user, input.Device, input.ReturnTokens)
+}
+
+// sendMagicLinkEmail mails the user a short-lived single-use sign-in link
+func sendMagicLinkEmail(user models.User) error {
+	token, err := authUtils.IssueOneTimeToken(authUtils.PurposeMagicLink, authUtils.OneTimeToken{UserID: user.ID.Hex()}, magicLinkTTL)
+	if err != nil {
+		return err
+	}
+
+	link := os.Getenv("CLIENT_URL") + "/magic-link?token=" + url.QueryEscape(token)
+	return mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Sign in to CivicSync",
+		Body: "Hi " + user.Name + ",\n\n" +
+			"Open the link below to sign in to CivicSync. It expires in 15 minutes and can be used once.\n\n" +
+			link + "\n\n" +
+			"If you did not ask for this, you can ignore this email.\n",
+	})
+}
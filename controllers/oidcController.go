@@ -0,0 +1,337 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"civicsync-be/models"
+	"civicsync-be/oidc"
+	authUtils "civicsync-be/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var errOIDCEmailUnverified = errors.New("provider did not return a verified email")
+
+// oidcLinkTokenTTL is how long the owner of a matched account has to sign in and confirm the link
+const oidcLinkTokenTTL = 15 * time.Minute
+
+// oidcStateCookie binds a login to the browser that started it
+const oidcStateCookie = "oidc_state"
+
+// GetOIDCProviders lists the identity providers users can sign in with
+func GetOIDCProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": oidc.Names()})
+}
+
+// StartOIDCLogin redirects the browser to the provider's sign-in page
+func StartOIDCLogin(c *gin.Context) {
+	provider, err := oidc.Get(c.Param("provider"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	authURL, state, err := provider.AuthCodeURL(ctx)
+	if err != nil {
+		log.Printf("Error starting %s login: %v", provider.Name, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+		return
+	}
+
+	setOIDCStateCookie(c, oidc.StateBinding(state), int(oidc.LoginStateTTL.Seconds()))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback finishes a provider sign-in, links or creates the account and redirects back to the client
+func OIDCCallback(c *gin.Context) {
+	provider, err := oidc.Get(c.Param("provider"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+		return
+	}
+
+	binding, _ := c.Cookie(oidcStateCookie)
+	setOIDCStateCookie(c, "", -1)
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		redirectToClient(c, "/login", url.Values{"error": {"oidc_denied"}})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	claims, err := provider.HandleCallback(ctx, c.Query("state"), binding, c.Query("code"))
+	if err != nil {
+		log.Printf("Error completing %s login: %v", provider.Name, err)
+		redirectToClient(c, "/login", url.Values{"error": {"oidc_failed"}})
+		return
+	}
+
+	user, err := findOrCreateOIDCUser(ctx, provider, claims)
+	var pending *oidcLinkRequired
+	if errors.As(err, &pending) {
+		redirectToLinkConfirmation(c, pending)
+		return
+	}
+	if err != nil {
+		log.Printf("Error signing in %s user: %v", provider.Name, err)
+		code := "oidc_failed"
+		if errors.Is(err, errOIDCEmailUnverified) {
+			code = "oidc_email_unverified"
+		}
+		redirectToClient(c, "/login", url.Values{"error": {code}})
+		return
+	}
+
+	// Same second step as LoginUser, handed to the client's 2FA page
+	if user.TwoFactorEnabled || user.TwoFactorRequired {
+		challenge, err := authUtils.IssueTwoFactorChallenge(user.ID.Hex())
+		if err != nil {
+			log.Println("Error issuing two-factor challenge:", err)
+			redirectToClient(c, "/login", url.Values{"error": {"oidc_failed"}})
+			return
+		}
+		redirectToClient(c, "/login/2fa", url.Values{
+			"challenge":     {challenge},
+			"setupRequired": {strconv.FormatBool(!user.TwoFactorEnabled)},
+		})
+		return
+	}
+
+	tokens, err := issueAuthTokens(c, user, "")
+	if err != nil {
+		log.Println("Error generating token:", err)
+		redirectToClient(c, "/login", url.Values{"error": {"oidc_failed"}})
+		return
+	}
+
+	setAuthCookies(c, tokens)
+	redirectToClient(c, "/", nil)
+}
+
+// findOrCreateOIDCUser returns the user linked to the provider account, or a new user for an unknown email.
+// An account that already has the email is only linked automatically for providers with TrustEmail;
+// otherwise an *oidcLinkRequired error asks its owner to confirm the link.
+func findOrCreateOIDCUser(ctx context.Context, provider *oidc.Provider, claims *oidc.IDTokenClaims) (models.User, error) {
+	var user models.User
+	err := userCollection.FindOne(ctx, bson.M{
+		"identities": bson.M{"$elemMatch": bson.M{"provider": provider.Name, "subject": claims.Subject}},
+		"deleted":    bson.M{"$ne": true},
+	}).Decode(&user)
+	if err == nil {
+		return user, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return user, err
+	}
+
+	email := models.NormalizeEmail(provider.TrustedEmail(claims))
+	if email == "" {
+		return user, errOIDCEmailUnverified
+	}
+
+	identity := models.ExternalIdentity{
+		Provider: provider.Name,
+		Subject:  claims.Subject,
+		Email:    email,
+		LinkedAt: time.Now(),
+	}
+
+	err = userCollection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	if err == nil {
+		if !provider.TrustEmail {
+			return user, &oidcLinkRequired{user: user, identity: identity}
+		}
+		return user, linkOIDCIdentity(ctx, user, identity)
+	}
+	if err != mongo.ErrNoDocuments {
+		return user, err
+	}
+
+	name := strings.TrimSpace(claims.Name)
+	if name == "" {
+		name, _, _ = strings.Cut(email, "@")
+	}
+	if runes := []rune(name); len(runes) > 50 {
+		name = string(runes[:50])
+	}
+
+	user = models.User{
+		Name:       name,
+		Email:      email,
+		Verified:   true,
+		Role:       models.RoleCitizen,
+		Identities: []models.ExternalIdentity{identity},
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+	result, err := userCollection.InsertOne(ctx, user)
+	if err != nil {
+		return user, err
+	}
+	user.ID = result.InsertedID.(primitive.ObjectID)
+
+	return user, nil
+}
+
+// oidcLinkRequired is returned when a provider account matches an existing user by email only
+type oidcLinkRequired struct {
+	user     models.User
+	identity models.ExternalIdentity
+}
+
+func (e *oidcLinkRequired) Error() string {
+	return "provider account matches an existing user and needs the owner's confirmation"
+}
+
+// redirectToLinkConfirmation sends the browser to the client's login page with a token the account owner
+// can redeem through ConfirmOIDCLink once signed in
+func redirectToLinkConfirmation(c *gin.Context, pending *oidcLinkRequired) {
+	token, err := authUtils.IssueOneTimeToken(authUtils.PurposeLinkIdentity, authUtils.OneTimeToken{
+		UserID:   pending.user.ID.Hex(),
+		Email:    pending.identity.Email,
+		Provider: pending.identity.Provider,
+		Subject:  pending.identity.Subject,
+	}, oidcLinkTokenTTL)
+	if err != nil {
+		log.Println("Error issuing identity link token:", err)
+		redirectToClient(c, "/login", url.Values{"error": {"oidc_failed"}})
+		return
+	}
+
+	redirectToClient(c, "/login", url.Values{
+		"error":     {"oidc_link_required"},
+		"provider":  {pending.identity.Provider},
+		"linkToken": {token},
+	})
+}
+
+// ConfirmOIDCLink links a provider account to the signed-in user after an OIDC sign-in matched their email
+func ConfirmOIDCLink(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	subject, err := authUtils.ConsumeOneTimeToken(authUtils.PurposeLinkIdentity, input.Token)
+	if err != nil || subject.Provider == "" || subject.Subject == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired link token"})
+		return
+	}
+	// The token only works for the account the provider email matched
+	if subject.UserID != objectID.Hex() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This link token belongs to another account"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"_id": objectID, "deleted": bson.M{"$ne": true}}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	identity := models.ExternalIdentity{
+		Provider: subject.Provider,
+		Subject:  subject.Subject,
+		Email:    subject.Email,
+		LinkedAt: time.Now(),
+	}
+	if err := linkOIDCIdentity(ctx, user, identity); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "This provider account is already linked to a user"})
+			return
+		}
+		log.Println("Error linking identity:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link the provider account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Provider account linked", "provider": identity.Provider})
+}
+
+// linkOIDCIdentity adds a provider account to an existing user.
+// An unverified local account may have been registered by someone else, so its password and sessions are dropped.
+func linkOIDCIdentity(ctx context.Context, user models.User, identity models.ExternalIdentity) error {
+	update := bson.M{
+		"$push": bson.M{"identities": identity},
+		"$set":  bson.M{"verified": true, "updatedAt": time.Now()},
+	}
+	if !user.Verified {
+		update["$unset"] = bson.M{"password": ""}
+	}
+
+	if _, err := userCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, update); err != nil {
+		return err
+	}
+
+	if !user.Verified {
+		if err := authUtils.RevokeAllSessions(user.ID.Hex()); err != nil {
+			log.Println("Error revoking sessions after linking identity:", err)
+		}
+	}
+	return nil
+}
+
+// setOIDCStateCookie writes or, with a negative maxAge, clears the cookie binding a login to the browser.
+// SameSite=Lax still sends it on the top-level redirect back from the provider.
+func setOIDCStateCookie(c *gin.Context, value string, maxAge int) {
+	environment := os.Getenv("GO_ENV")
+	domain := os.Getenv("DOMAIN")
+
+	if environment == "production" {
+		domain = ""
+	}
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		MaxAge:   maxAge,
+		Path:     "/api/auth/oidc", // only sent to the login and callback
+		Domain:   domain,
+		Secure:   environment == "production",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// redirectToClient sends the browser to a page of the frontend
+func redirectToClient(c *gin.Context, path string, params url.Values) {
+	target := os.Getenv("CLIENT_URL") + path
+	if len(params) > 0 {
+		target += "?" + params.Encode()
+	}
+	c.Redirect(http.StatusFound, target)
+}
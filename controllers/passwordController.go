@@ -0,0 +1,232 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"civicsync-be/config"
+	"civicsync-be/mailer"
+	"civicsync-be/models"
+	authUtils "civicsync-be/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const passwordResetTTL = 30 * time.Minute
+
+// ForgotPassword emails a password reset link. The response is identical whether or not the email is registered.
+func ForgotPassword(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.Email = models.NormalizeEmail(input.Email)
+
+	retryAfter, err := authUtils.AllowPasswordResetRequest(input.Email)
+	if err != nil {
+		log.Println("Error checking password reset rate limit:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+	if retryAfter > 0 {
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Too many reset links requested for this email, please try again later",
+			"retry_after": seconds,
+		})
+		return
+	}
+
+	userCollection := config.GetCollection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"email": input.Email}).Decode(&user); err == nil {
+		// Sending in the background keeps response times the same for unknown addresses
+		go func() {
+			if err := sendPasswordResetEmail(user); err != nil {
+				log.Println("Error sending password reset email:", err)
+			}
+		}()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "If an account exists for this email, a password reset link has been sent",
+	})
+}
+
+// ResetPassword sets a new password using a reset token and signs the user out everywhere
+func ResetPassword(c *gin.Context) {
+	var input struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required,min=6"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	subject, err := authUtils.ConsumeOneTimeToken(authUtils.PurposePasswordReset, input.Token)
+	if err != nil {
+		if errors.Is(err, authUtils.ErrOneTimeTokenInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset link"})
+			return
+		}
+		log.Println("Error consuming password reset token:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(subject.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset link"})
+		return
+	}
+
+	user := models.User{Password: input.Password}
+	if err := user.HashPassword(); err != nil {
+		log.Println("Error hashing password:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	userCollection := config.GetCollection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The reset link was delivered to the account's address, which also proves ownership of it
+	result, err := userCollection.UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{"$set": bson.M{
+		"password":  user.Password,
+		"verified":  true,
+		"updatedAt": time.Now(),
+	}})
+	if err != nil {
+		log.Println("Error updating password:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset link"})
+		return
+	}
+
+	if err := authUtils.RevokeAllSessions(subject.UserID); err != nil {
+		log.Println("Error revoking sessions after password reset:", err)
+	}
+	if err := revokeAPIKeys(ctx, objectID); err != nil {
+		log.Println("Error revoking API keys after password reset:", err)
+	}
+
+	clearAuthCookies(c)
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+}
+
+// sendPasswordResetEmail mails the user a short-lived single-use reset link
+func sendPasswordResetEmail(user models.User) error {
+	token, err := authUtils.IssueOneTimeToken(authUtils.PurposePasswordReset, authUtils.OneTimeToken{UserID: user.ID.Hex()}, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	link := os.Getenv("CLIENT_URL") + "/reset-password?token=" + url.QueryEscape(token)
+	return mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your CivicSync password",
+		Body: "Hi " + user.Name + ",\n\n" +
+			"Someone asked to reset the password for your CivicSync account. Open the link below to choose a new one. It expires in 30 minutes and can be used once.\n\n" +
+			link + "\n\n" +
+			"If you did not ask for this, you can ignore this email and your password will stay the same.\n",
+	})
+}
+
+// ChangePassword replaces the password after checking the current one and signs out every other session.
+// Accounts without a password set one after confirming with an emailed link.
+func ChangePassword(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var input struct {
+		CurrentPassword string `json:"currentPassword"`
+		ReauthToken     string `json:"reauthToken"`
+		NewPassword     string `json:"newPassword" binding:"required,min=6"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userCollection := config.GetCollection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	valid, err := confirmPassword(user, input.CurrentPassword, input.ReauthToken)
+	if err != nil {
+		log.Println("Error checking reauthentication:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+	if !valid {
+		rejectPassword(c, user, "Current password is incorrect")
+		return
+	}
+
+	user.Password = input.NewPassword
+	if err := user.HashPassword(); err != nil {
+		log.Println("Error hashing password:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	_, err = userCollection.UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{"$set": bson.M{
+		"password":  user.Password,
+		"updatedAt": time.Now(),
+	}})
+	if err != nil {
+		log.Println("Error updating password:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	currentSessionID, _ := c.Get("session_id")
+	keepSessionID, _ := currentSessionID.(string)
+	if err := authUtils.RevokeOtherSessions(user.ID.Hex(), keepSessionID); err != nil {
+		log.Println("Error revoking sessions after password change:", err)
+	}
+	if err := revokeAPIKeys(ctx, user.ID); err != nil {
+		log.Println("Error revoking API keys after password change:", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+}
@@ -0,0 +1,537 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"civicsync-be/config"
+	"civicsync-be/mailer"
+	"civicsync-be/models"
+	authUtils "civicsync-be/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const emailChangeTTL = 24 * time.Hour
+
+// UpdateProfile changes the authenticated user's name, avatar and anonymous reporting preference
+func UpdateProfile(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	// Name follows the same rules as RegisterUser
+	var input struct {
+		Name              *string `json:"name" binding:"omitempty,min=1,max=50"`
+		AvatarURL         *string `json:"avatarUrl" binding:"omitempty,max=500"`
+		ReportAnonymously *bool   `json:"reportAnonymously"`
+		PasswordlessLogin *bool   `json:"passwordlessLogin"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	update := bson.M{"updatedAt": time.Now()}
+	if input.Name != nil {
+		update["name"] = *input.Name
+	}
+	if input.AvatarURL != nil {
+		if *input.AvatarURL != "" {
+			if u, err := url.ParseRequestURI(*input.AvatarURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid avatar URL"})
+				return
+			}
+		}
+		update["avatarUrl"] = *input.AvatarURL
+	}
+	if input.ReportAnonymously != nil {
+		update["reportAnonymously"] = *input.ReportAnonymously
+	}
+
+	userCollection := config.GetCollection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if input.PasswordlessLogin != nil {
+		// Sign-in links are only sent to an address the user has proven is theirs
+		if *input.PasswordlessLogin {
+			var user models.User
+			if err := userCollection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&user); err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+				return
+			}
+			if !user.Verified {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Verify your email before enabling sign-in links"})
+				return
+			}
+		}
+		update["passwordlessLogin"] = *input.PasswordlessLogin
+	}
+
+	result, err := userCollection.UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{"$set": update})
+	if err != nil {
+		log.Println("Error updating profile:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	GetMe(c)
+}
+
+// RequestEmailChange sends a confirmation link to the new address; the email only changes once it is confirmed
+func RequestEmailChange(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var input struct {
+		Email       string `json:"email" binding:"required,email"`
+		Password    string `json:"password"`
+		ReauthToken string `json:"reauthToken"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.Email = models.NormalizeEmail(input.Email)
+
+	userCollection := config.GetCollection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	valid, err := confirmPassword(user, input.Password, input.ReauthToken)
+	if err != nil {
+		log.Println("Error checking reauthentication:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+	if !valid {
+		rejectPassword(c, user, "Password is incorrect")
+		return
+	}
+
+	if input.Email == user.Email {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This is already your email address"})
+		return
+	}
+
+	count, err := userCollection.CountDocuments(ctx, bson.M{"email": input.Email})
+	if err != nil {
+		log.Println("Error checking existing user:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+	if count > 0 {
+		respondEmailTaken(c)
+		return
+	}
+
+	token, err := authUtils.IssueOneTimeToken(authUtils.PurposeChangeEmail, authUtils.OneTimeToken{UserID: user.ID.Hex(), Email: input.Email}, emailChangeTTL)
+	if err != nil {
+		log.Println("Error generating email change token:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	link := os.Getenv("CLIENT_URL") + "/confirm-email?token=" + url.QueryEscape(token)
+	err = mailer.Send(mailer.Message{
+		To:      input.Email,
+		Subject: "Confirm your new CivicSync email address",
+		Body: "Hi " + user.Name + ",\n\n" +
+			"Open the link below to use this address for your CivicSync account. It expires in 24 hours.\n\n" +
+			link + "\n\n" +
+			"If you did not ask for this, you can ignore this email.\n",
+	})
+	if err != nil {
+		log.Println("Error sending email change confirmation:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send confirmation email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Confirmation email sent to the new address"})
+}
+
+// ConfirmEmailChange switches the account to the new address using the token from the confirmation email
+func ConfirmEmailChange(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	subject, err := authUtils.ConsumeOneTimeToken(authUtils.PurposeChangeEmail, input.Token)
+	if err != nil {
+		if errors.Is(err, authUtils.ErrOneTimeTokenInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired confirmation link"})
+			return
+		}
+		log.Println("Error consuming email change token:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(subject.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired confirmation link"})
+		return
+	}
+
+	userCollection := config.GetCollection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&user); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired confirmation link"})
+		return
+	}
+
+	// The address may have been registered since the link was sent
+	newEmail := models.NormalizeEmail(subject.Email)
+	count, err := userCollection.CountDocuments(ctx, bson.M{"email": newEmail, "_id": bson.M{"$ne": objectID}})
+	if err != nil {
+		log.Println("Error checking existing user:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+	if count > 0 {
+		respondEmailTaken(c)
+		return
+	}
+
+	_, err = userCollection.UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{"$set": bson.M{
+		"email":     newEmail,
+		"verified":  true,
+		"updatedAt": time.Now(),
+	}})
+	if mongo.IsDuplicateKeyError(err) {
+		respondEmailTaken(c)
+		return
+	}
+	if err != nil {
+		log.Println("Error updating email:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	// Let the previous address know, in case the change was not made by its owner
+	go func() {
+		err := mailer.Send(mailer.Message{
+			To:      user.Email,
+			Subject: "Your CivicSync email address was changed",
+			Body: "Hi " + user.Name + ",\n\n" +
+				"The email address of your CivicSync account was changed to " + newEmail + ".\n\n" +
+				"If you did not make this change, please reset your password and contact support.\n",
+		})
+		if err != nil {
+			log.Println("Error sending email change notice:", err)
+		}
+	}()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email changed successfully"})
+}
+
+// DeleteAccount schedules the authenticated user's account for deletion after a grace period
+func DeleteAccount(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var input struct {
+		Password    string `json:"password"`
+		ReauthToken string `json:"reauthToken"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userCollection := config.GetCollection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	valid, err := confirmPassword(user, input.Password, input.ReauthToken)
+	if err != nil {
+		log.Println("Error checking reauthentication:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+	if !valid {
+		rejectPassword(c, user, "Password is incorrect")
+		return
+	}
+
+	if user.DeletionScheduledAt != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message":             "Account deletion is already scheduled",
+			"deletionScheduledAt": user.DeletionScheduledAt,
+		})
+		return
+	}
+
+	scheduledAt := time.Now().Add(models.AccountDeletionGracePeriod)
+	_, err = userCollection.UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{"$set": bson.M{
+		"deletionScheduledAt": scheduledAt,
+		"updatedAt":           time.Now(),
+	}})
+	if err != nil {
+		log.Println("Error scheduling account deletion:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	go func() {
+		err := mailer.Send(mailer.Message{
+			To:      user.Email,
+			Subject: "Your CivicSync account will be deleted",
+			Body: "Hi " + user.Name + ",\n\n" +
+				"Your CivicSync account is scheduled for deletion on " + scheduledAt.Format("2 January 2006") + ".\n\n" +
+				"Until then you can sign in and cancel the deletion from your account settings. " +
+				"After that date your personal data is erased and the issues you reported are shown as reported by a deleted user.\n",
+		})
+		if err != nil {
+			log.Println("Error sending account deletion notice:", err)
+		}
+	}()
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":             "Account deletion scheduled",
+		"deletionScheduledAt": scheduledAt,
+	})
+}
+
+// CancelAccountDeletion cancels a pending account deletion during the grace period
+func CancelAccountDeletion(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	userCollection := config.GetCollection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := userCollection.UpdateOne(ctx,
+		bson.M{"_id": objectID, "deleted": bson.M{"$ne": true}, "deletionScheduledAt": bson.M{"$exists": true}},
+		bson.M{
+			"$unset": bson.M{"deletionScheduledAt": ""},
+			"$set":   bson.M{"updatedAt": time.Now()},
+		},
+	)
+	if err != nil {
+		log.Println("Error cancelling account deletion:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No account deletion is scheduled"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deletion cancelled"})
+}
+
+// RunAccountDeletions erases accounts whose grace period has ended, checking every interval
+func RunAccountDeletions(interval time.Duration) {
+	for {
+		purgeDueAccounts()
+		time.Sleep(interval)
+	}
+}
+
+// purgeDueAccounts erases every account whose scheduled deletion time has passed
+func purgeDueAccounts() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	cursor, err := userCollection.Find(ctx, bson.M{
+		"deleted":             bson.M{"$ne": true},
+		"deletionScheduledAt": bson.M{"$lte": time.Now()},
+	})
+	if err != nil {
+		log.Println("Error finding accounts due for deletion:", err)
+		return
+	}
+
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		log.Println("Error decoding accounts due for deletion:", err)
+		return
+	}
+
+	for _, user := range users {
+		if err := eraseAccount(ctx, user.ID); err != nil {
+			log.Printf("Error deleting account %s: %v", user.ID.Hex(), err)
+		}
+	}
+}
+
+// eraseAccount tombstones the user's PII and comments, detaches their votes and drops their credentials,
+// pending one-time links, login lockouts and exports. Issues are kept and shown as reported by a deleted user.
+func eraseAccount(ctx context.Context, userID primitive.ObjectID) error {
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		return err
+	}
+
+	if err := authUtils.RevokeAllSessions(userID.Hex()); err != nil {
+		return err
+	}
+	if err := authUtils.RevokeOneTimeTokens(userID.Hex()); err != nil {
+		return err
+	}
+
+	// Lockouts of the account are keyed by its email and record the IPs the attempts came from
+	if err := authUtils.ResetLoginFailures(user.Email); err != nil {
+		return err
+	}
+	if _, err := config.GetCollection("login_lockouts").DeleteMany(ctx, bson.M{
+		"scope":   authUtils.LockScopeAccount,
+		"subject": user.Email,
+	}); err != nil {
+		return err
+	}
+
+	if _, err := apiKeyCollection.DeleteMany(ctx, bson.M{"user": userID}); err != nil {
+		return err
+	}
+
+	cursor, err := exportCollection.Find(ctx, bson.M{"user": userID})
+	if err != nil {
+		return err
+	}
+	var exports []models.DataExport
+	if err := cursor.All(ctx, &exports); err != nil {
+		return err
+	}
+	for _, export := range exports {
+		if export.FilePath != "" {
+			if err := os.Remove(export.FilePath); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	if _, err := exportCollection.DeleteMany(ctx, bson.M{"user": userID}); err != nil {
+		return err
+	}
+
+	// Votes keep counting towards their issues but point at a fresh ID instead of the user
+	cursor, err = voteCollection.Find(ctx, bson.M{"user": userID})
+	if err != nil {
+		return err
+	}
+	var votes []models.Vote
+	if err := cursor.All(ctx, &votes); err != nil {
+		return err
+	}
+	for _, vote := range votes {
+		if _, err := voteCollection.UpdateOne(ctx, bson.M{"_id": vote.ID}, bson.M{"$set": bson.M{"user": primitive.NewObjectID()}}); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+
+	// Locations of photos not attached yet; attached ones already lost theirs
+	if _, err := assetCollection.UpdateMany(ctx, bson.M{"owner": userID, "location": bson.M{"$exists": true}},
+		bson.M{"$unset": bson.M{"location": ""}}); err != nil {
+		return err
+	}
+
+	// Comments keep their place in the threads they started, like comments the author deleted
+	_, err = commentCollection.UpdateMany(ctx, bson.M{"author": userID, "deleted": bson.M{"$ne": true}}, bson.M{"$set": bson.M{
+		"body":      "",
+		"deleted":   true,
+		"deletedAt": now,
+		"updatedAt": now,
+	}})
+	if err != nil {
+		return err
+	}
+
+	_, err = userCollection.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{
+		"$set": bson.M{
+			"name":      models.DeletedUserName,
+			"email":     "deleted-" + userID.Hex() + "@deleted.invalid",
+			"verified":  false,
+			"role":      models.RoleCitizen,
+			"deleted":   true,
+			"deletedAt": now,
+			"updatedAt": now,
+		},
+		"$unset": bson.M{
+			"password":            "",
+			"avatarUrl":           "",
+			"twoFactorEnabled":    "",
+			"twoFactorRequired":   "",
+			"twoFactorSecret":     "",
+			"pendingTotpSecret":   "",
+			"recoveryCodes":       "",
+			"identities":          "",
+			"deletionScheduledAt": "",
+		},
+	})
+	return err
+}
@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"civicsync-be/mailer"
+	"civicsync-be/models"
+	authUtils "civicsync-be/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const reauthTokenTTL = 15 * time.Minute
+
+// reauthentication is the proof of identity sensitive actions ask for on top of the session:
+// the current password, or a current authenticator code when two-factor authentication is on.
+// Accounts without a password send the token from an emailed confirmation link instead.
+type reauthentication struct {
+	Password    string `json:"password"`
+	Code        string `json:"code"`
+	ReauthToken string `json:"reauthToken"`
+}
+
+// verifyReauthentication reports whether the proof matches the user. A stolen session alone does not pass it.
+func verifyReauthentication(user models.User, proof reauthentication) (bool, error) {
+	if proof.Code != "" && user.TwoFactorEnabled {
+		return authUtils.ValidateTOTP(user.ID.Hex(), user.TwoFactorSecret, proof.Code)
+	}
+	return confirmPassword(user, proof.Password, proof.ReauthToken)
+}
+
+// confirmPassword checks the user's password. Accounts created through an OpenID Connect provider, or whose
+// password was dropped when their address was verified, have none and confirm with an emailed token instead.
+func confirmPassword(user models.User, password, reauthToken string) (bool, error) {
+	if user.Password != "" {
+		return password != "" && user.ComparePassword(password), nil
+	}
+	if reauthToken == "" {
+		return false, nil
+	}
+
+	subject, err := authUtils.ConsumeOneTimeToken(authUtils.PurposeReauthenticate, reauthToken)
+	if errors.Is(err, authUtils.ErrOneTimeTokenInvalid) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return subject.UserID == user.ID.Hex(), nil
+}
+
+// rejectPassword answers a request whose password, or confirmation token for accounts without one, did not match
+func rejectPassword(c *gin.Context, user models.User, message string) {
+	if user.Password == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":          "Confirm this action with the link sent to your email",
+			"reauthRequired": true,
+		})
+		return
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+}
+
+// RequestReauthentication emails a confirmation link to users without a password, who cannot otherwise
+// confirm sensitive actions such as deleting their account
+func RequestReauthentication(c *gin.Context) {
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.Password != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Confirm with your password instead"})
+		return
+	}
+
+	retryAfter, err := authUtils.AllowReauthRequest(user.Email)
+	if err != nil {
+		log.Println("Error checking reauthentication rate limit:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+	if retryAfter > 0 {
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Too many confirmation links requested, please try again later",
+			"retry_after": seconds,
+		})
+		return
+	}
+
+	if err := sendReauthenticationEmail(user); err != nil {
+		log.Println("Error sending reauthentication email:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "A confirmation link has been sent to your email"})
+}
+
+// sendReauthenticationEmail mails the user a short-lived single-use link confirming a sensitive action
+func sendReauthenticationEmail(user models.User) error {
+	token, err := authUtils.IssueOneTimeToken(authUtils.PurposeReauthenticate, authUtils.OneTimeToken{UserID: user.ID.Hex()}, reauthTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	link := os.Getenv("CLIENT_URL") + "/confirm-action?token=" + url.QueryEscape(token)
+	return mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your action on CivicSync",
+		Body: "Hi " + user.Name + ",\n\n" +
+			"Open the link below to confirm the change you are making to your CivicSync account, such as changing your email or deleting your account. It expires in 15 minutes and can be used once.\n\n" +
+			link + "\n\n" +
+			"If you did not ask for this, you can ignore this email and nothing will change.\n",
+	})
+}
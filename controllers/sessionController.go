@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	authUtils "civicsync-be/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSessions lists the authenticated user's active sessions
+func GetSessions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	currentSessionID, _ := c.Get("session_id")
+
+	sessions, err := authUtils.ListSessions(userID.(string))
+	if err != nil {
+		log.Println("Error listing sessions:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSessionID
+	}
+
+	// Most recently active first
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeen.After(sessions[j].LastSeen)
+	})
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession ends one of the authenticated user's sessions
+func RevokeSession(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	currentSessionID, _ := c.Get("session_id")
+	sessionID := c.Param("id")
+
+	if err := authUtils.RevokeSession(userID.(string), sessionID); err != nil {
+		if errors.Is(err, authUtils.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		log.Println("Error revoking session:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	if sessionID == currentSessionID {
+		clearAuthCookies(c)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
+
+// LogoutAllSessions ends every session of the authenticated user, including the current one
+func LogoutAllSessions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := authUtils.RevokeAllSessions(userID.(string)); err != nil {
+		log.Println("Error revoking sessions:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	clearAuthCookies(c)
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out of all devices successfully"})
+}
+
+// describeDevice derives a coarse device label from a User-Agent header
+func describeDevice(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case ua == "":
+		return "Unknown device"
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"):
+		return "iOS device"
+	case strings.Contains(ua, "android"):
+		return "Android device"
+	case strings.Contains(ua, "windows"):
+		return "Windows computer"
+	case strings.Contains(ua, "mac os"):
+		return "Mac"
+	case strings.Contains(ua, "linux"):
+		return "Linux computer"
+	default:
+		return "Unknown device"
+	}
+}
@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"civicsync-be/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetIssueTimeline returns the status history of an issue, oldest first
+func GetIssueTimeline(c *gin.Context) {
+	issueID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid issue ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	count, err := issueCollection.CountDocuments(ctx, bson.M{"_id": issueID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve issue"})
+		return
+	}
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Issue not found"})
+		return
+	}
+
+	cursor, err := timelineCollection.Find(ctx, bson.M{"issue": issueID},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve timeline"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var changes []models.IssueStatusChange
+	if err := cursor.All(ctx, &changes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode timeline"})
+		return
+	}
+
+	type TimelineEntry struct {
+		models.IssueStatusChange
+		Actor models.PublicUser `json:"actor"`
+	}
+
+	actorIDs := make([]primitive.ObjectID, 0, len(changes))
+	for _, change := range changes {
+		actorIDs = append(actorIDs, change.Actor)
+	}
+	actors := newCreatorLookup(c)
+	actors.prefetch(ctx, actorIDs)
+
+	timeline := make([]TimelineEntry, 0, len(changes))
+	for _, change := range changes {
+		timeline = append(timeline, TimelineEntry{
+			IssueStatusChange: change,
+			Actor:             actors.creator(ctx, change.Actor),
+		})
+	}
+
+	c.JSON(http.StatusOK, timeline)
+}
+
+// recordStatusChange appends an entry to an issue's timeline. Callers fail the request when it cannot be
+// written, so the timeline never misses a status the issue has had.
+func recordStatusChange(ctx context.Context, change *models.IssueStatusChange) error {
+	change.ID = primitive.NewObjectID()
+	change.CreatedAt = time.Now()
+
+	_, err := timelineCollection.InsertOne(ctx, change)
+	return err
+}
+
+// forgetStatusChange removes a timeline entry whose status change was not saved after all
+func forgetStatusChange(ctx context.Context, change *models.IssueStatusChange) {
+	if _, err := timelineCollection.DeleteOne(ctx, bson.M{"_id": change.ID}); err != nil {
+		log.Printf("Error removing status change %s of issue %s: %v", change.ID.Hex(), change.Issue.Hex(), err)
+	}
+}
@@ -0,0 +1,494 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"civicsync-be/models"
+	authUtils "civicsync-be/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const recoveryCodeCount = 10
+
+// SetupTwoFactor starts enrollment by generating a secret for the authenticated user's authenticator app
+func SetupTwoFactor(c *gin.Context) {
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.TwoFactorEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	respondTOTPSetup(c, user)
+}
+
+// ConfirmTwoFactor enables two-factor authentication once the user proves their app produces valid codes
+func ConfirmTwoFactor(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.TwoFactorEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if user.PendingTOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start two-factor setup first"})
+		return
+	}
+
+	valid, err := authUtils.ValidateTOTP(user.ID.Hex(), user.PendingTOTPSecret, input.Code)
+	if err != nil {
+		log.Println("Error validating TOTP code:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	recoveryCodes, err := enableTwoFactor(user)
+	if err != nil {
+		log.Println("Error enabling two-factor authentication:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	currentSessionID, _ := c.Get("session_id")
+	keepSessionID, _ := currentSessionID.(string)
+	if err := authUtils.RevokeOtherSessions(user.ID.Hex(), keepSessionID); err != nil {
+		log.Println("Error revoking sessions after enabling two-factor authentication:", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Two-factor authentication enabled",
+		"recoveryCodes": recoveryCodes,
+	})
+}
+
+// DisableTwoFactor turns two-factor authentication off after checking the password, or the emailed link for
+// accounts without one, and a current code
+func DisableTwoFactor(c *gin.Context) {
+	var input struct {
+		Password     string `json:"password"`
+		ReauthToken  string `json:"reauthToken"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recoveryCode"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	if !user.TwoFactorEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if user.TwoFactorRequired {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for your account"})
+		return
+	}
+	valid, err := confirmPassword(user, input.Password, input.ReauthToken)
+	if err != nil {
+		log.Println("Error checking reauthentication:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+	if !valid {
+		rejectPassword(c, user, "Password is incorrect")
+		return
+	}
+
+	valid, err = checkSecondFactor(user, input.Code, input.RecoveryCode)
+	if err != nil {
+		log.Println("Error checking second factor:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err = userCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{
+		"$unset": bson.M{"twoFactorEnabled": "", "twoFactorSecret": "", "pendingTotpSecret": "", "recoveryCodes": ""},
+		"$set":   bson.M{"updatedAt": time.Now()},
+	})
+	if err != nil {
+		log.Println("Error disabling two-factor authentication:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes; the old ones stop working
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	if !user.TwoFactorEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	valid, err := authUtils.ValidateTOTP(user.ID.Hex(), user.TwoFactorSecret, input.Code)
+	if err != nil {
+		log.Println("Error validating TOTP code:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	codes, hashes, err := authUtils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		log.Println("Error generating recovery codes:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err = userCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{
+		"recoveryCodes": hashes,
+		"updatedAt":     time.Now(),
+	}})
+	if err != nil {
+		log.Println("Error storing recovery codes:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+}
+
+// SetupTwoFactorLogin lets a user whose account requires two-factor authentication enroll during login
+func SetupTwoFactorLogin(c *gin.Context) {
+	var input struct {
+		Challenge string `json:"challenge" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := loadChallengeUser(c, input.Challenge)
+	if !ok {
+		return
+	}
+
+	if user.TwoFactorEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	respondTOTPSetup(c, user)
+}
+
+// VerifyTwoFactorLogin completes a login with an authenticator or recovery code.
+// Users enrolling during login confirm their new secret here and get their recovery codes back.
+func VerifyTwoFactorLogin(c *gin.Context) {
+	var input struct {
+		Challenge    string `json:"challenge" binding:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recoveryCode"`
+		Device       string `json:"device,omitempty" binding:"max=100"`
+		ReturnTokens bool   `json:"returnTokens,omitempty"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Code == "" && input.RecoveryCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A code or recovery code is required"})
+		return
+	}
+
+	user, ok := loadChallengeUser(c, input.Challenge)
+	if !ok {
+		return
+	}
+
+	// Wrong codes count against the same lockout as wrong passwords, so starting
+	// a new challenge with the password does not buy more guesses
+	clientIP := c.ClientIP()
+	locked, err := authUtils.LoginLockRemaining(user.Email, clientIP)
+	if err != nil {
+		log.Println("Error checking login lock:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+	if locked > 0 {
+		respondLoginLocked(c, locked)
+		return
+	}
+
+	var valid bool
+	enrolling := !user.TwoFactorEnabled
+	switch {
+	case enrolling && user.PendingTOTPSecret == "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Set up two-factor authentication first"})
+		return
+	case enrolling:
+		valid, err = authUtils.ValidateTOTP(user.ID.Hex(), user.PendingTOTPSecret, input.Code)
+	default:
+		valid, err = checkSecondFactor(user, input.Code, input.RecoveryCode)
+	}
+	if err != nil {
+		log.Println("Error checking second factor:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+	if !valid {
+		if err := authUtils.RecordTwoFactorFailure(input.Challenge); err != nil {
+			log.Println("Error recording two-factor failure:", err)
+		}
+		if locked := recordFailedLogin(user.Email, clientIP); locked > 0 {
+			respondLoginLocked(c, locked)
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	completed, err := authUtils.CompleteTwoFactorChallenge(input.Challenge)
+	if err != nil {
+		log.Println("Error completing two-factor challenge:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+	if !completed {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login session expired, please log in again"})
+		return
+	}
+
+	var recoveryCodes []string
+	if enrolling {
+		recoveryCodes, err = enableTwoFactor(user)
+		if err != nil {
+			log.Println("Error enabling two-factor authentication:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+			return
+		}
+		user.TwoFactorEnabled = true
+	}
+
+	response, err := startLoginSession(c, user, input.Device, input.ReturnTokens)
+	if err != nil {
+		log.Println("Error generating token:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+	if recoveryCodes != nil {
+		response["recoveryCodes"] = recoveryCodes
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// respondTwoFactorChallenge answers a successful first login step with a challenge instead of a session
+func respondTwoFactorChallenge(c *gin.Context, user models.User) {
+	challenge, err := authUtils.IssueTwoFactorChallenge(user.ID.Hex())
+	if err != nil {
+		log.Println("Error issuing two-factor challenge:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"twoFactorRequired": true,
+		// Accounts that must use 2FA but have not enrolled yet call /2fa/login/setup first
+		"setupRequired": !user.TwoFactorEnabled,
+		"challenge":     challenge,
+		"expiresIn":     int(authUtils.TwoFactorChallengeTTL.Seconds()),
+	})
+}
+
+// respondTOTPSetup stores a new pending secret for the user and returns it with its otpauth URI
+func respondTOTPSetup(c *gin.Context, user models.User) {
+	secret, err := authUtils.GenerateTOTPSecret()
+	if err != nil {
+		log.Println("Error generating TOTP secret:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err = userCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{
+		"pendingTotpSecret": secret,
+		"updatedAt":         time.Now(),
+	}})
+	if err != nil {
+		log.Println("Error storing TOTP secret:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":     secret,
+		"otpauthUri": authUtils.TOTPURI(secret, user.Email),
+	})
+}
+
+// enableTwoFactor promotes the pending secret, revokes the user's API keys and returns a fresh set of recovery codes
+func enableTwoFactor(user models.User) ([]string, error) {
+	codes, hashes, err := authUtils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err = userCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{
+		"$set": bson.M{
+			"twoFactorEnabled": true,
+			"twoFactorSecret":  user.PendingTOTPSecret,
+			"recoveryCodes":    hashes,
+			"updatedAt":        time.Now(),
+		},
+		"$unset": bson.M{"pendingTotpSecret": ""},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys created before would keep working without the second factor
+	if err := revokeAPIKeys(ctx, user.ID); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// checkSecondFactor accepts either a current authenticator code or an unused recovery code, which is then spent
+func checkSecondFactor(user models.User, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		return authUtils.ValidateTOTP(user.ID.Hex(), user.TwoFactorSecret, code)
+	}
+	if recoveryCode == "" {
+		return false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	codeHash := authUtils.HashRecoveryCode(recoveryCode)
+	result, err := userCollection.UpdateOne(ctx,
+		bson.M{"_id": user.ID, "recoveryCodes": codeHash},
+		bson.M{"$pull": bson.M{"recoveryCodes": codeHash}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// loadCurrentUser loads the authenticated user, responding with an error if that fails
+func loadCurrentUser(c *gin.Context) (models.User, bool) {
+	var user models.User
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return user, false
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return user, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := userCollection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return user, false
+	}
+
+	return user, true
+}
+
+// loadChallengeUser loads the user a pending login challenge belongs to, responding with an error if that fails
+func loadChallengeUser(c *gin.Context, challenge string) (models.User, bool) {
+	var user models.User
+
+	userID, err := authUtils.TwoFactorChallengeUser(challenge)
+	if err != nil {
+		if !errors.Is(err, authUtils.ErrTwoFactorChallengeInvalid) {
+			log.Println("Error loading two-factor challenge:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+			return user, false
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login session expired, please log in again"})
+		return user, false
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login session expired, please log in again"})
+		return user, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := userCollection.FindOne(ctx, bson.M{"_id": objectID, "deleted": bson.M{"$ne": true}}).Decode(&user); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login session expired, please log in again"})
+		return user, false
+	}
+
+	return user, true
+}
@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"civicsync-be/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GetPublicProfile returns the public view of a user; anonymous and deleted users have no public profile
+func GetPublicProfile(c *gin.Context) {
+	profileID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"_id": profileID}).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		}
+		return
+	}
+
+	lookup := newCreatorLookup(c)
+	if user.Deleted || (user.ReportAnonymously && !lookup.seesPrivateDetails(user.ID)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, lookup.project(ctx, user))
+}
+
+// creatorLookup builds the createdBy projection of issue responses for the requesting user, caching by creator
+type creatorLookup struct {
+	viewerID   *primitive.ObjectID
+	viewerRole models.Role
+	cache      map[primitive.ObjectID]models.PublicUser
+}
+
+// newCreatorLookup reads the requesting user, if any, from the auth context
+func newCreatorLookup(c *gin.Context) *creatorLookup {
+	lookup := &creatorLookup{
+		viewerRole: models.RoleCitizen,
+		cache:      make(map[primitive.ObjectID]models.PublicUser),
+	}
+	if userID, exists := c.Get("user_id"); exists {
+		if objID, err := primitive.ObjectIDFromHex(userID.(string)); err == nil {
+			lookup.viewerID = &objID
+			lookup.viewerRole = currentUserRole(c)
+		}
+	}
+	return lookup
+}
+
+// seesPrivateDetails reports whether the viewer may see the email and real name of the given user
+func (l *creatorLookup) seesPrivateDetails(userID primitive.ObjectID) bool {
+	if l.viewerID != nil && *l.viewerID == userID {
+		return true
+	}
+	return l.viewerRole.CanViewReporterContact()
+}
+
+// creator returns the projection of the issue creator shown to the viewer
+func (l *creatorLookup) creator(ctx context.Context, creatorID primitive.ObjectID) models.PublicUser {
+	if info, ok := l.cache[creatorID]; ok {
+		return info
+	}
+	l.prefetch(ctx, []primitive.ObjectID{creatorID})
+	return l.cache[creatorID]
+}
+
+// prefetch loads the given users and their reputations with one query each, so listing many issues or
+// comments does not cost a query per author
+func (l *creatorLookup) prefetch(ctx context.Context, userIDs []primitive.ObjectID) {
+	missing := make([]primitive.ObjectID, 0, len(userIDs))
+	for _, id := range userIDs {
+		if _, ok := l.cache[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	for _, id := range missing {
+		l.cache[id] = models.PublicUser{Name: models.DeletedUserName}
+	}
+
+	var users []models.User
+	cursor, err := userCollection.Find(ctx, bson.M{"_id": bson.M{"$in": missing}})
+	if err != nil || cursor.All(ctx, &users) != nil {
+		return
+	}
+
+	reputations := userReputations(ctx, missing)
+	for _, user := range users {
+		l.cache[user.ID] = l.projectWithReputation(user, reputations[user.ID])
+	}
+}
+
+// project applies the viewer's visibility rules to a user
+func (l *creatorLookup) project(ctx context.Context, user models.User) models.PublicUser {
+	if user.Deleted {
+		return user.Public(0)
+	}
+	return l.projectWithReputation(user, userReputations(ctx, []primitive.ObjectID{user.ID})[user.ID])
+}
+
+// projectWithReputation is project for callers that already know the user's reputation
+func (l *creatorLookup) projectWithReputation(user models.User, reputation int64) models.PublicUser {
+	if user.Deleted {
+		return user.Public(0)
+	}
+	if !l.seesPrivateDetails(user.ID) {
+		return user.Public(reputation)
+	}
+
+	// The user themself and staff see through the anonymous flag
+	visible := user
+	visible.ReportAnonymously = false
+	info := visible.Public(reputation)
+	info.Email = user.Email
+	return info
+}
+
+// userReputations counts, for each user, the votes other residents gave to the user's issues
+func userReputations(ctx context.Context, userIDs []primitive.ObjectID) map[primitive.ObjectID]int64 {
+	reputations := make(map[primitive.ObjectID]int64, len(userIDs))
+
+	cursor, err := issueCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"createdBy": bson.M{"$in": userIDs}}}},
+		{{Key: "$lookup", Value: bson.M{"from": "votes", "localField": "_id", "foreignField": "issue", "as": "votes"}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": "$createdBy",
+			"reputation": bson.M{"$sum": bson.M{"$size": bson.M{"$filter": bson.M{
+				"input": "$votes",
+				"cond":  bson.M{"$ne": bson.A{"$$this.user", "$createdBy"}},
+			}}}},
+		}}},
+	})
+	if err != nil {
+		return reputations
+	}
+
+	var results []struct {
+		User       primitive.ObjectID `bson:"_id"`
+		Reputation int64              `bson:"reputation"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return reputations
+	}
+	for _, result := range results {
+		reputations[result.User] = result.Reputation
+	}
+	return reputations
+}
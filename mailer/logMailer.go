@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogMailer writes messages to the application log and optionally appends them to a file.
+// It is meant for local development where no SMTP relay is available.
+type LogMailer struct {
+	Path string
+	mu   sync.Mutex
+}
+
+// NewLogMailer returns a LogMailer; an empty path only logs
+func NewLogMailer(path string) *LogMailer {
+	return &LogMailer{Path: path}
+}
+
+// Send logs the message and appends it to the configured file
+func (m *LogMailer) Send(msg Message) error {
+	log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+
+	if m.Path == "" {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "Date: %s\nTo: %s\nSubject: %s\n\n%s\n\n----\n\n",
+		time.Now().Format(time.RFC1123Z), msg.To, msg.Subject, msg.Body)
+	return err
+}
@@ -0,0 +1,45 @@
+package mailer
+
+import (
+	"log"
+	"os"
+	"sync"
+)
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email messages
+type Mailer interface {
+	Send(msg Message) error
+}
+
+var (
+	defaultMailer Mailer
+	once          sync.Once
+)
+
+// Default returns the mailer selected by MAIL_DRIVER ("smtp" or "log", defaulting to "log")
+func Default() Mailer {
+	once.Do(func() {
+		switch os.Getenv("MAIL_DRIVER") {
+		case "smtp":
+			defaultMailer = NewSMTPMailer()
+		case "", "log":
+			defaultMailer = NewLogMailer(os.Getenv("MAIL_LOG_FILE"))
+		default:
+			log.Fatalf("Unknown MAIL_DRIVER %q", os.Getenv("MAIL_DRIVER"))
+		}
+	})
+
+	return defaultMailer
+}
+
+// Send delivers a message through the default mailer
+func Send(msg Message) error {
+	return Default().Send(msg)
+}
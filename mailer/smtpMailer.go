@@ -0,0 +1,57 @@
+package mailer
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+// SMTPMailer sends messages through an SMTP relay
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// NewSMTPMailer builds an SMTPMailer from the SMTP_* and MAIL_FROM environment variables
+func NewSMTPMailer() *SMTPMailer {
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+
+	return &SMTPMailer{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     port,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("MAIL_FROM"),
+	}
+}
+
+// Send delivers the message, authenticating only when credentials are configured
+func (m *SMTPMailer) Send(msg Message) error {
+	if m.Host == "" || m.From == "" {
+		return fmt.Errorf("SMTP_HOST and MAIL_FROM must be set to send email")
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	var body strings.Builder
+	body.WriteString("From: " + m.From + "\r\n")
+	body.WriteString("To: " + msg.To + "\r\n")
+	body.WriteString("Subject: " + msg.Subject + "\r\n")
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	body.WriteString("\r\n")
+	body.WriteString(msg.Body)
+
+	return smtp.SendMail(net.JoinHostPort(m.Host, m.Port), auth, m.From, []string{msg.To}, []byte(body.String()))
+}
@@ -2,7 +2,12 @@ package main
 
 import (
 	"civicsync-be/config"
+	"civicsync-be/controllers"
+	"civicsync-be/models"
 	"civicsync-be/routes"
+	"civicsync-be/storage"
+	authUtils "civicsync-be/utils"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -24,8 +29,52 @@ func main() {
 	}
 	config.ConnectRedis()
 
+	if err := authUtils.LoadSigningKeys(); err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
+
 	log.Println("MongoDB connection established successfully!")
 
+	if err := models.BackfillUserDefaults(config.GetCollection("users")); err != nil {
+		// Logins would be ambiguous while accounts share an email
+		if errors.Is(err, models.ErrEmailCollisions) {
+			log.Fatalf("Failed to backfill user defaults: %v", err)
+		}
+		log.Printf("Failed to backfill user defaults: %v", err)
+	}
+	if err := models.EnsureUserEmailIndex(config.GetCollection("users")); err != nil {
+		log.Fatalf("Failed to create user email index: %v", err)
+	}
+	if err := models.EnsureUserIdentityIndex(config.GetCollection("users")); err != nil {
+		log.Printf("Failed to create user identity index: %v", err)
+	}
+	if err := models.EnsureAPIKeyIndex(config.GetCollection("api_keys")); err != nil {
+		log.Printf("Failed to create API key index: %v", err)
+	}
+	if err := models.EnsureCommentIndex(config.GetCollection("comments")); err != nil {
+		log.Printf("Failed to create comment index: %v", err)
+	}
+
+	// ADMIN_EMAIL bootstraps the first admin: register and verify that account, then restart the server.
+	// Further admins are granted through PATCH /api/admin/users/:id/role.
+	if adminEmail := os.Getenv("ADMIN_EMAIL"); adminEmail != "" {
+		promoted, err := models.PromoteBootstrapAdmin(config.GetCollection("users"), adminEmail)
+		switch {
+		case err != nil:
+			log.Printf("Failed to promote ADMIN_EMAIL to admin: %v", err)
+		case !promoted:
+			log.Printf("ADMIN_EMAIL %s has no verified account yet; register it, verify it and restart to make it an admin", adminEmail)
+		}
+	}
+
+	// Fails fast on a misconfigured STORAGE_DRIVER or STORAGE_DIR rather than on the first upload
+	storage.Default()
+
+	go controllers.RunAccountDeletions(time.Hour)
+	go controllers.RunAssetCleanup(time.Hour)
+	go controllers.RunExportCleanup(time.Hour)
+	go controllers.RunDataExportWorkers(2)
+
 	r := gin.Default()
 	var clientURL = os.Getenv("CLIENT_URL")
 	fmt.Println("Client URL:", clientURL)
@@ -33,14 +82,18 @@ func main() {
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{clientURL}, // frontend URL
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-API-Key", "X-CSRF-Token"},
+		ExposeHeaders:    []string{"Content-Length", "X-Renewed-Access-Token"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
 	routes.AuthRoutes(r)
 	routes.IssueRoutes(r)
+	routes.AdminRoutes(r)
+	routes.UserRoutes(r)
+	routes.AssetRoutes(r)
+	routes.WellKnownRoutes(r)
 	r.GET("/ping", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "pong"})
 	})
@@ -0,0 +1,367 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+	"time"
+)
+
+// EXIF tags we read
+const (
+	tagOrientation      = 0x0112
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagDateTimeOriginal = 0x9003
+
+	tagGPSLatitudeRef      = 0x0001
+	tagGPSLatitude         = 0x0002
+	tagGPSLongitudeRef     = 0x0003
+	tagGPSLongitude        = 0x0004
+	tagGPSTimeStamp        = 0x0007
+	tagGPSDOP              = 0x000B
+	tagGPSDateStamp        = 0x001D
+	tagGPSPositioningError = 0x001F
+)
+
+// TIFF field types we read
+const (
+	typeASCII    = 2
+	typeShort    = 3
+	typeLong     = 4
+	typeRational = 5
+)
+
+var errNoExif = errors.New("no EXIF data")
+
+// exifInfo is the metadata we use from a photo before it is stripped
+type exifInfo struct {
+	// Orientation is 1-8 as defined by EXIF; 1 means upright
+	Orientation int
+
+	HasGPS    bool
+	Latitude  float64
+	Longitude float64
+	// GPSResolution is the finest step the coordinates were recorded with, in degrees
+	GPSResolution float64
+	// GPSError is the horizontal positioning error in metres and GPSDOP the dilution of precision; 0 when not recorded
+	GPSError float64
+	GPSDOP   float64
+	// GPSTime is the UTC time of the GPS fix; zero when not recorded
+	GPSTime time.Time
+	// DateTimeOriginal is when the photo was taken in the camera's unknown local time zone, read as UTC
+	DateTimeOriginal time.Time
+}
+
+// tiffReader reads IFD entries from the TIFF structure inside an EXIF segment
+type tiffReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+// ifdEntry is one tag of an image file directory; valueOffset points at its 4-byte value field
+type ifdEntry struct {
+	typ         uint16
+	count       uint32
+	valueOffset int
+}
+
+// rational is an unsigned TIFF fraction
+type rational struct {
+	num, den uint32
+}
+
+func (r rational) float() float64 {
+	return float64(r.num) / float64(r.den)
+}
+
+// jpegExif returns the TIFF payload of the first EXIF APP1 segment of a JPEG
+func jpegExif(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, errNoExif
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return nil, errNoExif
+		}
+		marker := data[i+1]
+		// Fill bytes may pad markers
+		if marker == 0xFF {
+			i++
+			continue
+		}
+		// Start of scan or end of image: no metadata follows
+		if marker == 0xDA || marker == 0xD9 {
+			return nil, errNoExif
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return nil, errNoExif
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:], nil
+		}
+		i += 2 + length
+	}
+
+	return nil, errNoExif
+}
+
+// newTIFFReader checks the TIFF header and returns a reader along with the offset of IFD0
+func newTIFFReader(data []byte) (*tiffReader, int, error) {
+	if len(data) < 8 {
+		return nil, 0, errNoExif
+	}
+
+	t := &tiffReader{data: data}
+	switch string(data[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, 0, errNoExif
+	}
+	if t.order.Uint16(data[2:]) != 42 {
+		return nil, 0, errNoExif
+	}
+
+	return t, int(t.order.Uint32(data[4:])), nil
+}
+
+// readIFD returns the entries of the directory at off keyed by tag
+func (t *tiffReader) readIFD(off int) (map[uint16]ifdEntry, error) {
+	if off < 8 || off+2 > len(t.data) {
+		return nil, errNoExif
+	}
+
+	n := int(t.order.Uint16(t.data[off:]))
+	if off+2+n*12 > len(t.data) {
+		return nil, errNoExif
+	}
+
+	entries := make(map[uint16]ifdEntry, n)
+	for i := 0; i < n; i++ {
+		e := t.data[off+2+i*12:]
+		entries[t.order.Uint16(e)] = ifdEntry{
+			typ:         t.order.Uint16(e[2:]),
+			count:       t.order.Uint32(e[4:]),
+			valueOffset: off + 2 + i*12 + 8,
+		}
+	}
+
+	return entries, nil
+}
+
+// value returns the raw bytes of an entry whose values are size bytes each.
+// Values that do not fit in the entry are stored elsewhere, at the offset the entry holds.
+func (t *tiffReader) value(e ifdEntry, size int) ([]byte, bool) {
+	n := int(e.count) * size
+	if e.count == 0 || n/size != int(e.count) {
+		return nil, false
+	}
+
+	off := e.valueOffset
+	if n > 4 {
+		off = int(t.order.Uint32(t.data[e.valueOffset:]))
+	}
+	if off < 0 || off+n > len(t.data) {
+		return nil, false
+	}
+	return t.data[off : off+n], true
+}
+
+// short reads the first value of a SHORT entry
+func (t *tiffReader) short(e ifdEntry) (uint16, bool) {
+	if e.typ != typeShort {
+		return 0, false
+	}
+	b, ok := t.value(e, 2)
+	if !ok {
+		return 0, false
+	}
+	return t.order.Uint16(b), true
+}
+
+// long reads the first value of a LONG entry, as used for pointers to sub-directories
+func (t *tiffReader) long(e ifdEntry) (uint32, bool) {
+	if e.typ != typeLong {
+		return 0, false
+	}
+	b, ok := t.value(e, 4)
+	if !ok {
+		return 0, false
+	}
+	return t.order.Uint32(b), true
+}
+
+// ascii reads an ASCII entry without its NUL terminator
+func (t *tiffReader) ascii(e ifdEntry) (string, bool) {
+	if e.typ != typeASCII {
+		return "", false
+	}
+	b, ok := t.value(e, 1)
+	if !ok {
+		return "", false
+	}
+	return strings.TrimRight(string(b), "\x00 "), true
+}
+
+// rationals reads every value of a RATIONAL entry, rejecting zero denominators
+func (t *tiffReader) rationals(e ifdEntry) ([]rational, bool) {
+	if e.typ != typeRational {
+		return nil, false
+	}
+	b, ok := t.value(e, 8)
+	if !ok {
+		return nil, false
+	}
+
+	values := make([]rational, e.count)
+	for i := range values {
+		values[i] = rational{t.order.Uint32(b[i*8:]), t.order.Uint32(b[i*8+4:])}
+		if values[i].den == 0 {
+			return nil, false
+		}
+	}
+	return values, true
+}
+
+// parseExif reads the metadata of a JPEG; photos without EXIF yield an upright orientation and nothing else
+func parseExif(data []byte) exifInfo {
+	info := exifInfo{Orientation: 1}
+
+	payload, err := jpegExif(data)
+	if err != nil {
+		return info
+	}
+	t, ifd0Offset, err := newTIFFReader(payload)
+	if err != nil {
+		return info
+	}
+	ifd0, err := t.readIFD(ifd0Offset)
+	if err != nil {
+		return info
+	}
+
+	if entry, ok := ifd0[tagOrientation]; ok {
+		if orientation, ok := t.short(entry); ok && orientation >= 1 && orientation <= 8 {
+			info.Orientation = int(orientation)
+		}
+	}
+
+	if entry, ok := ifd0[tagExifIFD]; ok {
+		if off, ok := t.long(entry); ok {
+			if exifIFD, err := t.readIFD(int(off)); err == nil {
+				if entry, ok := exifIFD[tagDateTimeOriginal]; ok {
+					if s, ok := t.ascii(entry); ok {
+						info.DateTimeOriginal, _ = time.Parse("2006:01:02 15:04:05", s)
+					}
+				}
+			}
+		}
+	}
+
+	if entry, ok := ifd0[tagGPSIFD]; ok {
+		if off, ok := t.long(entry); ok {
+			if gps, err := t.readIFD(int(off)); err == nil {
+				t.readGPS(gps, &info)
+			}
+		}
+	}
+
+	return info
+}
+
+// readGPS fills the GPS fields of info from the GPS directory
+func (t *tiffReader) readGPS(gps map[uint16]ifdEntry, info *exifInfo) {
+	lat, latRes, ok := t.coordinate(gps, tagGPSLatitude, tagGPSLatitudeRef, "N", "S")
+	if !ok {
+		return
+	}
+	lon, lonRes, ok := t.coordinate(gps, tagGPSLongitude, tagGPSLongitudeRef, "E", "W")
+	if !ok {
+		return
+	}
+
+	info.HasGPS = true
+	info.Latitude, info.Longitude = lat, lon
+	info.GPSResolution = math.Max(latRes, lonRes)
+
+	if entry, ok := gps[tagGPSPositioningError]; ok {
+		if values, ok := t.rationals(entry); ok {
+			info.GPSError = values[0].float()
+		}
+	}
+	if entry, ok := gps[tagGPSDOP]; ok {
+		if values, ok := t.rationals(entry); ok {
+			info.GPSDOP = values[0].float()
+		}
+	}
+
+	dateEntry, hasDate := gps[tagGPSDateStamp]
+	timeEntry, hasTime := gps[tagGPSTimeStamp]
+	if !hasDate || !hasTime {
+		return
+	}
+	dateStamp, ok := t.ascii(dateEntry)
+	if !ok {
+		return
+	}
+	day, err := time.Parse("2006:01:02", dateStamp)
+	if err != nil {
+		return
+	}
+	hms, ok := t.rationals(timeEntry)
+	if !ok || len(hms) != 3 {
+		return
+	}
+	seconds := hms[0].float()*3600 + hms[1].float()*60 + hms[2].float()
+	if seconds < 0 || seconds >= 24*3600 {
+		return
+	}
+	info.GPSTime = day.Add(time.Duration(seconds * float64(time.Second)))
+}
+
+// coordinate reads a latitude or longitude stored as degrees, minutes and seconds along with its hemisphere.
+// The resolution is the step of the finest non-zero component, so coordinates rounded on purpose,
+// e.g. written as 1234/100 degrees with zero minutes and seconds, come out as coarse as they really are.
+func (t *tiffReader) coordinate(gps map[uint16]ifdEntry, valueTag, refTag uint16, positive, negative string) (float64, float64, bool) {
+	valueEntry, ok := gps[valueTag]
+	if !ok {
+		return 0, 0, false
+	}
+	refEntry, ok := gps[refTag]
+	if !ok {
+		return 0, 0, false
+	}
+
+	dms, ok := t.rationals(valueEntry)
+	if !ok || len(dms) != 3 {
+		return 0, 0, false
+	}
+	ref, ok := t.ascii(refEntry)
+	if !ok || (ref != positive && ref != negative) {
+		return 0, 0, false
+	}
+
+	value := dms[0].float() + dms[1].float()/60 + dms[2].float()/3600
+	if ref == negative {
+		value = -value
+	}
+
+	resolution := 1 / float64(dms[0].den)
+	if dms[1].num != 0 {
+		resolution = 1 / (60 * float64(dms[1].den))
+	}
+	if dms[2].num != 0 {
+		resolution = 1 / (3600 * float64(dms[2].den))
+	}
+
+	return value, resolution, true
+}
@@ -0,0 +1,286 @@
+package media
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+)
+
+// tiffBuilder lays out a TIFF structure as cameras write it into the EXIF segment of a JPEG
+type tiffBuilder struct {
+	order binary.ByteOrder
+	buf   []byte
+}
+
+// testTag is one directory entry; data holds its values already encoded in the builder's byte order
+type testTag struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+func newTIFF(order binary.ByteOrder) *tiffBuilder {
+	b := &tiffBuilder{order: order, buf: make([]byte, 8)}
+	if order == binary.LittleEndian {
+		copy(b.buf, "II")
+	} else {
+		copy(b.buf, "MM")
+	}
+	order.PutUint16(b.buf[2:], 42)
+	order.PutUint32(b.buf[4:], 8)
+	return b
+}
+
+// setIFD0 points the header at the directory read first
+func (b *tiffBuilder) setIFD0(off int) {
+	b.order.PutUint32(b.buf[4:], uint32(off))
+}
+
+// ifd appends a directory followed by the values that do not fit in its entries and returns its offset
+func (b *tiffBuilder) ifd(tags ...testTag) int {
+	off := len(b.buf)
+	values := off + 2 + len(tags)*12 + 4
+
+	dir := make([]byte, 2+len(tags)*12+4)
+	b.order.PutUint16(dir, uint16(len(tags)))
+	var extra []byte
+	for i, tag := range tags {
+		e := dir[2+i*12:]
+		b.order.PutUint16(e, tag.tag)
+		b.order.PutUint16(e[2:], tag.typ)
+		b.order.PutUint32(e[4:], tag.count)
+		if len(tag.data) <= 4 {
+			copy(e[8:], tag.data)
+			continue
+		}
+		b.order.PutUint32(e[8:], uint32(values+len(extra)))
+		extra = append(extra, tag.data...)
+	}
+
+	b.buf = append(b.buf, dir...)
+	b.buf = append(b.buf, extra...)
+	return off
+}
+
+func (b *tiffBuilder) short(tag, value uint16) testTag {
+	data := make([]byte, 2)
+	b.order.PutUint16(data, value)
+	return testTag{tag: tag, typ: typeShort, count: 1, data: data}
+}
+
+func (b *tiffBuilder) long(tag uint16, value uint32) testTag {
+	data := make([]byte, 4)
+	b.order.PutUint32(data, value)
+	return testTag{tag: tag, typ: typeLong, count: 1, data: data}
+}
+
+func (b *tiffBuilder) ascii(tag uint16, value string) testTag {
+	return testTag{tag: tag, typ: typeASCII, count: uint32(len(value) + 1), data: append([]byte(value), 0)}
+}
+
+func (b *tiffBuilder) rationals(tag uint16, values ...rational) testTag {
+	data := make([]byte, 8*len(values))
+	for i, v := range values {
+		b.order.PutUint32(data[i*8:], v.num)
+		b.order.PutUint32(data[i*8+4:], v.den)
+	}
+	return testTag{tag: tag, typ: typeRational, count: uint32(len(values)), data: data}
+}
+
+// jpegWithExif wraps a TIFF structure in an EXIF APP1 segment, followed by an end of image marker
+func jpegWithExif(tiff []byte) []byte {
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	data := []byte{0xFF, 0xD8, 0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(data[4:], uint16(len(segment)+2))
+	data = append(data, segment...)
+	return append(data, 0xFF, 0xD9)
+}
+
+// sampleTIFF is a complete EXIF structure as a phone writes it: orientation, capture time and a GPS fix
+func sampleTIFF(order binary.ByteOrder) []byte {
+	b := newTIFF(order)
+	exifIFD := b.ifd(b.ascii(tagDateTimeOriginal, "2026:10:01 14:30:00"))
+	gpsIFD := b.ifd(
+		b.ascii(tagGPSLatitudeRef, "N"),
+		b.rationals(tagGPSLatitude, rational{52, 1}, rational{31, 1}, rational{1234, 100}),
+		b.ascii(tagGPSLongitudeRef, "E"),
+		b.rationals(tagGPSLongitude, rational{13, 1}, rational{24, 1}, rational{3, 1}),
+		b.rationals(tagGPSTimeStamp, rational{12, 1}, rational{29, 1}, rational{58, 1}),
+		b.ascii(tagGPSDateStamp, "2026:10:01"),
+		b.rationals(tagGPSDOP, rational{12, 10}),
+		b.rationals(tagGPSPositioningError, rational{5, 1}),
+	)
+	b.setIFD0(b.ifd(
+		b.short(tagOrientation, 6),
+		b.long(tagExifIFD, uint32(exifIFD)),
+		b.long(tagGPSIFD, uint32(gpsIFD)),
+	))
+	return b.buf
+}
+
+func TestParseExifReadsSample(t *testing.T) {
+	for name, order := range map[string]binary.ByteOrder{"little endian": binary.LittleEndian, "big endian": binary.BigEndian} {
+		t.Run(name, func(t *testing.T) {
+			info := parseExif(jpegWithExif(sampleTIFF(order)))
+
+			if info.Orientation != 6 {
+				t.Errorf("Orientation = %d, want 6", info.Orientation)
+			}
+			if want := time.Date(2026, 10, 1, 14, 30, 0, 0, time.UTC); !info.DateTimeOriginal.Equal(want) {
+				t.Errorf("DateTimeOriginal = %v, want %v", info.DateTimeOriginal, want)
+			}
+			if !info.HasGPS {
+				t.Fatal("GPS position was not read")
+			}
+			if want := 52 + 31.0/60 + 12.34/3600; math.Abs(info.Latitude-want) > 1e-9 {
+				t.Errorf("Latitude = %v, want %v", info.Latitude, want)
+			}
+			if want := 13 + 24.0/60 + 3.0/3600; math.Abs(info.Longitude-want) > 1e-9 {
+				t.Errorf("Longitude = %v, want %v", info.Longitude, want)
+			}
+			if want := time.Date(2026, 10, 1, 12, 29, 58, 0, time.UTC); !info.GPSTime.Equal(want) {
+				t.Errorf("GPSTime = %v, want %v", info.GPSTime, want)
+			}
+			if info.GPSDOP != 1.2 || info.GPSError != 5 {
+				t.Errorf("GPSDOP, GPSError = %v, %v, want 1.2, 5", info.GPSDOP, info.GPSError)
+			}
+		})
+	}
+}
+
+func TestParseExifOrientation(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  func(b *tiffBuilder) testTag
+		want int
+	}{
+		{"upright", func(b *tiffBuilder) testTag { return b.short(tagOrientation, 1) }, 1},
+		{"mirrored horizontally", func(b *tiffBuilder) testTag { return b.short(tagOrientation, 2) }, 2},
+		{"rotated 180°", func(b *tiffBuilder) testTag { return b.short(tagOrientation, 3) }, 3},
+		{"mirrored vertically", func(b *tiffBuilder) testTag { return b.short(tagOrientation, 4) }, 4},
+		{"transposed", func(b *tiffBuilder) testTag { return b.short(tagOrientation, 5) }, 5},
+		{"rotated 90° clockwise", func(b *tiffBuilder) testTag { return b.short(tagOrientation, 6) }, 6},
+		{"transversed", func(b *tiffBuilder) testTag { return b.short(tagOrientation, 7) }, 7},
+		{"rotated 90° counter-clockwise", func(b *tiffBuilder) testTag { return b.short(tagOrientation, 8) }, 8},
+		{"zero", func(b *tiffBuilder) testTag { return b.short(tagOrientation, 0) }, 1},
+		{"out of range", func(b *tiffBuilder) testTag { return b.short(tagOrientation, 9) }, 1},
+		{"stored as a LONG", func(b *tiffBuilder) testTag { return b.long(tagOrientation, 6) }, 1},
+		{"no values", func(b *tiffBuilder) testTag { return testTag{tag: tagOrientation, typ: typeShort} }, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTIFF(binary.BigEndian)
+			b.ifd(tt.tag(b))
+
+			if got := parseExif(jpegWithExif(b.buf)).Orientation; got != tt.want {
+				t.Fatalf("Orientation = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExifRejectsMalformedStructure(t *testing.T) {
+	// looping points both sub-directory pointers and the next directory of IFD0 back at IFD0 itself
+	b := newTIFF(binary.LittleEndian)
+	ifd0 := b.ifd(b.short(tagOrientation, 3), b.long(tagExifIFD, 8), b.long(tagGPSIFD, 8))
+	binary.LittleEndian.PutUint32(b.buf[ifd0+2+3*12:], uint32(ifd0))
+	looping := b.buf
+
+	tests := []struct {
+		name string
+		data []byte
+		want exifInfo
+	}{
+		{"not a JPEG", []byte("GIF89a\x01\x00\x01\x00"), exifInfo{Orientation: 1}},
+		{"JPEG without EXIF", []byte{0xFF, 0xD8, 0xFF, 0xD9}, exifInfo{Orientation: 1}},
+		{"segment longer than the file", []byte{0xFF, 0xD8, 0xFF, 0xE1, 0xFF, 0xFF, 'E', 'x', 'i', 'f', 0, 0}, exifInfo{Orientation: 1}},
+		{"segment length below its own size", []byte{0xFF, 0xD8, 0xFF, 0xE1, 0, 1, 0xFF, 0xD9}, exifInfo{Orientation: 1}},
+		{"bad TIFF magic", jpegWithExif([]byte("II\x2B\x00\x08\x00\x00\x00")), exifInfo{Orientation: 1}},
+		{"IFD0 beyond the payload", jpegWithExif([]byte("MM\x00\x2A\xFF\xFF\xFF\xFF")), exifInfo{Orientation: 1}},
+		{"IFD0 inside the header", jpegWithExif([]byte("MM\x00\x2A\x00\x00\x00\x02\x00\x00")), exifInfo{Orientation: 1}},
+		{"IFD with more entries than bytes", jpegWithExif([]byte("MM\x00\x2A\x00\x00\x00\x08\xFF\xFF\x01\x12\x00\x03")), exifInfo{Orientation: 1}},
+		{"looping directories", jpegWithExif(looping), exifInfo{Orientation: 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseExif(tt.data); got != tt.want {
+				t.Fatalf("parseExif() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExifRejectsOversizedValues(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  testTag
+	}{
+		// count × 8 bytes points far beyond the payload
+		{"huge rational count", testTag{tag: tagGPSLatitude, typ: typeRational, count: math.MaxUint32, data: []byte{0, 0, 0, 16}}},
+		{"value offset beyond the payload", testTag{tag: tagGPSLatitude, typ: typeRational, count: 3, data: []byte{0x7F, 0xFF, 0xFF, 0xFF}}},
+		{"value offset near the 4 GiB limit", testTag{tag: tagGPSLatitude, typ: typeRational, count: 3, data: []byte{0xFF, 0xFF, 0xFF, 0xF0}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTIFF(binary.BigEndian)
+			gpsIFD := b.ifd(
+				b.ascii(tagGPSLatitudeRef, "N"),
+				tt.tag,
+				b.ascii(tagGPSLongitudeRef, "E"),
+				b.rationals(tagGPSLongitude, rational{13, 1}, rational{24, 1}, rational{3, 1}),
+			)
+			b.setIFD0(b.ifd(b.long(tagGPSIFD, uint32(gpsIFD))))
+
+			if info := parseExif(jpegWithExif(b.buf)); info.HasGPS {
+				t.Fatalf("read a GPS position from a broken entry: %+v", info)
+			}
+		})
+	}
+}
+
+// TestParseExifTruncated cuts a complete EXIF structure at every length; no cut may panic or invent values
+func TestParseExifTruncated(t *testing.T) {
+	tiff := sampleTIFF(binary.LittleEndian)
+	full := parseExif(jpegWithExif(tiff))
+
+	for n := 0; n < len(tiff); n++ {
+		info := parseExif(jpegWithExif(tiff[:n]))
+		if info.Orientation != 1 && info.Orientation != full.Orientation {
+			t.Fatalf("cut at %d: Orientation = %d", n, info.Orientation)
+		}
+		if info.HasGPS && (info.Latitude != full.Latitude || info.Longitude != full.Longitude) {
+			t.Fatalf("cut at %d: position %v, %v differs from the full one", n, info.Latitude, info.Longitude)
+		}
+	}
+
+	// A JPEG cut inside the EXIF segment has no EXIF at all
+	data := jpegWithExif(tiff)
+	for n := 0; n < len(data)-2; n++ {
+		if info := parseExif(data[:n]); info != (exifInfo{Orientation: 1}) {
+			t.Fatalf("cut at %d: parseExif() = %+v", n, info)
+		}
+	}
+}
+
+func FuzzParseEXIF(f *testing.F) {
+	f.Add(jpegWithExif(sampleTIFF(binary.LittleEndian)))
+	f.Add(jpegWithExif(sampleTIFF(binary.BigEndian)))
+	f.Add([]byte{0xFF, 0xD8, 0xFF, 0xD9})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		info := parseExif(data)
+		if info.Orientation < 1 || info.Orientation > 8 {
+			t.Fatalf("Orientation = %d", info.Orientation)
+		}
+
+		location := info.location(time.Now())
+		if location != nil && (math.Abs(location.Latitude) > 90 || math.Abs(location.Longitude) > 180) {
+			t.Fatalf("location out of range: %+v", location)
+		}
+	})
+}
@@ -0,0 +1,207 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"time"
+)
+
+const (
+	// MaxUploadSize is the largest photo we accept, in bytes
+	MaxUploadSize = 10 << 20
+	// maxPixels guards against small files that decode to enormous images. Processing takes about 10 bytes
+	// per pixel (decoded image, RGBA copy, rotated copy), so a 24 MP photo peaks around 240 MB.
+	maxPixels = 24_000_000
+	// maxConcurrentDecodes bounds how many photos are decoded at once, and with it the memory they take
+	maxConcurrentDecodes = 2
+	// thumbnailSize is the longest edge of a thumbnail, in pixels
+	thumbnailSize = 400
+	jpegQuality   = 85
+)
+
+var (
+	// ErrUnsupportedType is returned for files that are not JPEG or PNG images, whatever their name claims
+	ErrUnsupportedType = errors.New("only JPEG and PNG images are supported")
+	// ErrInvalidImage is returned for files that look like images but do not decode
+	ErrInvalidImage = errors.New("the image could not be read")
+	// ErrTooManyPixels is returned for images whose dimensions exceed maxPixels
+	ErrTooManyPixels = errors.New("the image dimensions are too large")
+)
+
+// decodeSlots is a semaphore with maxConcurrentDecodes slots; further uploads wait for a free one
+var decodeSlots = make(chan struct{}, maxConcurrentDecodes)
+
+// Image is an uploaded photo re-encoded without metadata, along with its thumbnail
+type Image struct {
+	Data        []byte
+	Thumbnail   []byte
+	ContentType string
+	Extension   string
+	Width       int
+	Height      int
+	// Location is where the photo was taken according to its EXIF GPS tags, when they pass our sanity checks
+	Location *Location
+}
+
+// Process validates an uploaded photo by sniffing its content and re-encodes it.
+// Re-encoding drops EXIF and any other metadata; the EXIF orientation is applied to the pixels first
+// so photos taken on phones stay upright, and the GPS position is kept aside as Location.
+func Process(data []byte) (*Image, error) {
+	contentType := http.DetectContentType(data)
+	if contentType != "image/jpeg" && contentType != "image/png" {
+		return nil, ErrUnsupportedType
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, ErrInvalidImage
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, ErrTooManyPixels
+	}
+
+	decodeSlots <- struct{}{}
+	defer func() { <-decodeSlots }()
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	img := toRGBA(decoded)
+	var location *Location
+	if contentType == "image/jpeg" {
+		info := parseExif(data)
+		img = orient(img, info.Orientation)
+		location = info.location(time.Now())
+	}
+
+	result := &Image{
+		ContentType: contentType,
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+		Location:    location,
+	}
+	if result.Data, err = encode(img, contentType); err != nil {
+		return nil, err
+	}
+	if result.Thumbnail, err = encode(thumbnail(img, thumbnailSize), contentType); err != nil {
+		return nil, err
+	}
+
+	result.Extension = ".png"
+	if contentType == "image/jpeg" {
+		result.Extension = ".jpg"
+	}
+
+	return result, nil
+}
+
+func encode(img image.Image, contentType string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if contentType == "image/jpeg" {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	return buf.Bytes(), err
+}
+
+// toRGBA copies any decoded image into an RGBA image anchored at the origin
+func toRGBA(src image.Image) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+	return dst
+}
+
+// orient applies an EXIF orientation so the image displays upright without it
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	// Orientations 5-8 swap the axes
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for dy := 0; dy < dh; dy++ {
+		for dx := 0; dx < dw; dx++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				sx, sy = w-1-dx, dy
+			case 3: // rotated 180°
+				sx, sy = w-1-dx, h-1-dy
+			case 4: // mirrored vertically
+				sx, sy = dx, h-1-dy
+			case 5: // transposed
+				sx, sy = dy, dx
+			case 6: // rotated 90° clockwise
+				sx, sy = dy, h-1-dx
+			case 7: // transversed
+				sx, sy = w-1-dy, h-1-dx
+			case 8: // rotated 90° counter-clockwise
+				sx, sy = w-1-dy, dx
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+
+	return dst
+}
+
+// thumbnail scales the image down so its longest edge is at most size, averaging the covered source pixels
+func thumbnail(src *image.RGBA, size int) *image.RGBA {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	if w <= size && h <= size {
+		return src
+	}
+
+	tw, th := size, h*size/w
+	if h > w {
+		tw, th = w*size/h, size
+	}
+	tw, th = max(tw, 1), max(th, 1)
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for ty := 0; ty < th; ty++ {
+		y0, y1 := ty*h/th, max((ty+1)*h/th, ty*h/th+1)
+		for tx := 0; tx < tw; tx++ {
+			x0, x1 := tx*w/tw, max((tx+1)*w/tw, tx*w/tw+1)
+
+			var r, g, b, a, n int
+			for y := y0; y < y1; y++ {
+				row := src.Pix[src.PixOffset(x0, y) : src.PixOffset(x1-1, y)+4]
+				for i := 0; i < len(row); i += 4 {
+					r += int(row[i])
+					g += int(row[i+1])
+					b += int(row[i+2])
+					a += int(row[i+3])
+					n++
+				}
+			}
+
+			i := dst.PixOffset(tx, ty)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
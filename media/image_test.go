@@ -0,0 +1,138 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// numbered returns a w×h image whose pixels are numbered 1, 2, 3, ... row by row in the red channel
+func numbered(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(y*w + x + 1), A: 255})
+		}
+	}
+	return img
+}
+
+// rows reads back the pixel numbers of an image row by row
+func rows(img *image.RGBA) [][]uint8 {
+	b := img.Bounds()
+	out := make([][]uint8, b.Dy())
+	for y := range out {
+		out[y] = make([]uint8, b.Dx())
+		for x := range out[y] {
+			out[y][x] = img.RGBAAt(x, y).R
+		}
+	}
+	return out
+}
+
+func TestOrient(t *testing.T) {
+	// The stored image is 1 2 3 / 4 5 6; want is how it has to be turned to display upright
+	tests := []struct {
+		orientation int
+		want        [][]uint8
+	}{
+		{0, [][]uint8{{1, 2, 3}, {4, 5, 6}}},
+		{1, [][]uint8{{1, 2, 3}, {4, 5, 6}}},
+		{2, [][]uint8{{3, 2, 1}, {6, 5, 4}}},
+		{3, [][]uint8{{6, 5, 4}, {3, 2, 1}}},
+		{4, [][]uint8{{4, 5, 6}, {1, 2, 3}}},
+		{5, [][]uint8{{1, 4}, {2, 5}, {3, 6}}},
+		{6, [][]uint8{{4, 1}, {5, 2}, {6, 3}}},
+		{7, [][]uint8{{6, 3}, {5, 2}, {4, 1}}},
+		{8, [][]uint8{{3, 6}, {2, 5}, {1, 4}}},
+		{9, [][]uint8{{1, 2, 3}, {4, 5, 6}}},
+	}
+
+	for _, tt := range tests {
+		got := rows(orient(numbered(3, 2), tt.orientation))
+		if len(got) != len(tt.want) {
+			t.Errorf("orientation %d: got %d rows, want %d", tt.orientation, len(got), len(tt.want))
+			continue
+		}
+		for y := range got {
+			if !bytes.Equal(got[y], tt.want[y]) {
+				t.Errorf("orientation %d: got %v, want %v", tt.orientation, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+// withExif inserts an EXIF segment right after the start of image marker of a JPEG
+func withExif(jpegData, tiff []byte) []byte {
+	segment := jpegWithExif(tiff)
+	segment = segment[2 : len(segment)-2]
+	return append(append(append([]byte(nil), jpegData[:2]...), segment...), jpegData[2:]...)
+}
+
+func TestProcessAppliesOrientation(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, numbered(30, 20), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for orientation := uint16(1); orientation <= 8; orientation++ {
+		b := newTIFF(binary.BigEndian)
+		b.ifd(b.short(tagOrientation, orientation))
+
+		img, err := Process(withExif(buf.Bytes(), b.buf))
+		if err != nil {
+			t.Fatalf("orientation %d: %v", orientation, err)
+		}
+
+		wantW, wantH := 30, 20
+		if orientation >= 5 {
+			wantW, wantH = 20, 30
+		}
+		if img.Width != wantW || img.Height != wantH {
+			t.Errorf("orientation %d: %d×%d, want %d×%d", orientation, img.Width, img.Height, wantW, wantH)
+		}
+		// The re-encoded photo carries no EXIF, so viewers do not rotate it a second time
+		if info := parseExif(img.Data); info != (exifInfo{Orientation: 1}) {
+			t.Errorf("orientation %d: metadata survived re-encoding: %+v", orientation, info)
+		}
+	}
+}
+
+func TestProcessRejectsBadImages(t *testing.T) {
+	var small bytes.Buffer
+	if err := png.Encode(&small, numbered(2, 2)); err != nil {
+		t.Fatal(err)
+	}
+
+	// huge claims 10000×10000 pixels in its header but holds the data of a 2×2 image
+	huge := append([]byte(nil), small.Bytes()...)
+	binary.BigEndian.PutUint32(huge[16:], 10000)
+	binary.BigEndian.PutUint32(huge[20:], 10000)
+	binary.BigEndian.PutUint32(huge[29:], crc32.ChecksumIEEE(huge[12:29]))
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"not an image", []byte("%PDF-1.7\n"), ErrUnsupportedType},
+		{"GIF", []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;"), ErrUnsupportedType},
+		{"truncated JPEG", []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10, 'J', 'F', 'I', 'F', 0}, ErrInvalidImage},
+		{"too many pixels", huge, ErrTooManyPixels},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Process(tt.data); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
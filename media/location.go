@@ -0,0 +1,73 @@
+package media
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// maxLocationResolution rejects coordinates recorded more coarsely than about 100 m
+	maxLocationResolution = 0.001
+	// maxPositioningError rejects fixes whose reported horizontal error exceeds this many metres
+	maxPositioningError = 100
+	// maxDOP rejects fixes with a poor satellite geometry
+	maxDOP = 10
+	// maxLocationAge rejects photos taken too long ago to still show the current state of a place
+	maxLocationAge = 30 * 24 * time.Hour
+	// clockSkew allows for wrong camera clocks and, for DateTimeOriginal, the unknown time zone
+	clockSkew = 14 * time.Hour
+)
+
+// Location is where a photo was taken according to its EXIF GPS tags
+type Location struct {
+	Latitude   float64
+	Longitude  float64
+	CapturedAt time.Time
+}
+
+// location returns the GPS position of the photo if it is precise and recent enough to offer as an issue location.
+// Phones often write a stale cached fix or a deliberately coarse position, so anything doubtful is dropped.
+func (info exifInfo) location(now time.Time) *Location {
+	if !info.HasGPS {
+		return nil
+	}
+
+	if math.IsNaN(info.Latitude) || math.IsNaN(info.Longitude) ||
+		math.Abs(info.Latitude) > 90 || math.Abs(info.Longitude) > 180 {
+		return nil
+	}
+	// 0,0 is what broken GPS stacks write when they have no fix
+	if info.Latitude == 0 && info.Longitude == 0 {
+		return nil
+	}
+	if info.GPSResolution > maxLocationResolution {
+		return nil
+	}
+	if info.GPSError > maxPositioningError || info.GPSDOP > maxDOP {
+		return nil
+	}
+
+	// A fix taken long before the shutter fired is a cached position from somewhere else
+	if !info.GPSTime.IsZero() && !info.DateTimeOriginal.IsZero() &&
+		info.GPSTime.Sub(info.DateTimeOriginal).Abs() > clockSkew {
+		return nil
+	}
+
+	capturedAt := info.GPSTime
+	if capturedAt.IsZero() {
+		capturedAt = info.DateTimeOriginal
+	}
+	// Without a timestamp we cannot tell a fresh fix from a stale one
+	if capturedAt.IsZero() {
+		return nil
+	}
+	if capturedAt.After(now.Add(clockSkew)) || capturedAt.Before(now.Add(-maxLocationAge-clockSkew)) {
+		return nil
+	}
+
+	return &Location{
+		Latitude:   info.Latitude,
+		Longitude:  info.Longitude,
+		CapturedAt: capturedAt,
+	}
+}
@@ -0,0 +1,187 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/jpeg"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLocation(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	fix := now.Add(-time.Hour)
+
+	// valid is a precise, recent fix; each case changes one thing about it
+	valid := exifInfo{
+		Orientation:      1,
+		HasGPS:           true,
+		Latitude:         52.52,
+		Longitude:        13.405,
+		GPSResolution:    1.0 / 360000,
+		GPSError:         5,
+		GPSDOP:           1.2,
+		GPSTime:          fix,
+		DateTimeOriginal: fix.Add(2 * time.Hour), // local time ahead of UTC
+	}
+
+	tests := []struct {
+		name   string
+		change func(info *exifInfo)
+		want   bool
+	}{
+		{"valid", func(info *exifInfo) {}, true},
+		{"no GPS", func(info *exifInfo) { info.HasGPS = false }, false},
+		{"null island", func(info *exifInfo) { info.Latitude, info.Longitude = 0, 0 }, false},
+		{"on the equator", func(info *exifInfo) { info.Latitude = 0 }, true},
+		{"on the prime meridian", func(info *exifInfo) { info.Longitude = 0 }, true},
+		{"southern and western hemispheres", func(info *exifInfo) { info.Latitude, info.Longitude = -33.86, -70.65 }, true},
+		{"latitude beyond the pole", func(info *exifInfo) { info.Latitude = 90.5 }, false},
+		{"longitude beyond the antimeridian", func(info *exifInfo) { info.Longitude = -180.5 }, false},
+		{"at the pole", func(info *exifInfo) { info.Latitude = -90 }, true},
+		{"NaN", func(info *exifInfo) { info.Longitude = math.NaN() }, false},
+		{"whole degrees", func(info *exifInfo) { info.GPSResolution = 1 }, false},
+		{"rounded to 100 m", func(info *exifInfo) { info.GPSResolution = maxLocationResolution }, true},
+		{"large positioning error", func(info *exifInfo) { info.GPSError = 250 }, false},
+		{"poor DOP", func(info *exifInfo) { info.GPSDOP = 25 }, false},
+		{"stale cached fix", func(info *exifInfo) { info.GPSTime = fix.Add(-3 * 24 * time.Hour) }, false},
+		{"GPS time only", func(info *exifInfo) { info.DateTimeOriginal = time.Time{} }, true},
+		{"camera time only", func(info *exifInfo) { info.GPSTime = time.Time{} }, true},
+		{"no time at all", func(info *exifInfo) { info.GPSTime, info.DateTimeOriginal = time.Time{}, time.Time{} }, false},
+		{"taken two months ago", func(info *exifInfo) {
+			info.GPSTime = now.Add(-60 * 24 * time.Hour)
+			info.DateTimeOriginal = info.GPSTime
+		}, false},
+		{"taken in the future", func(info *exifInfo) {
+			info.GPSTime = now.Add(48 * time.Hour)
+			info.DateTimeOriginal = info.GPSTime
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := valid
+			tt.change(&info)
+
+			location := info.location(now)
+			if (location != nil) != tt.want {
+				t.Fatalf("location() = %+v, want a location: %v", location, tt.want)
+			}
+			if location != nil && (location.Latitude != info.Latitude || location.Longitude != info.Longitude) {
+				t.Fatalf("location() = %+v, want %v, %v", location, info.Latitude, info.Longitude)
+			}
+		})
+	}
+}
+
+// TestReadGPS covers the GPS directory as cameras write it, with the references that give coordinates their sign
+func TestReadGPS(t *testing.T) {
+	latitude := []rational{{52, 1}, {31, 1}, {1234, 100}}
+	longitude := []rational{{13, 1}, {24, 1}, {3, 1}}
+
+	tests := []struct {
+		name       string
+		tags       func(b *tiffBuilder) []testTag
+		want       bool
+		lat        float64
+		lon        float64
+		resolution float64
+	}{
+		{"north east", func(b *tiffBuilder) []testTag {
+			return []testTag{b.ascii(tagGPSLatitudeRef, "N"), b.rationals(tagGPSLatitude, latitude...),
+				b.ascii(tagGPSLongitudeRef, "E"), b.rationals(tagGPSLongitude, longitude...)}
+		}, true, 52 + 31.0/60 + 12.34/3600, 13 + 24.0/60 + 3.0/3600, 1.0 / 3600},
+		{"south west", func(b *tiffBuilder) []testTag {
+			return []testTag{b.ascii(tagGPSLatitudeRef, "S"), b.rationals(tagGPSLatitude, latitude...),
+				b.ascii(tagGPSLongitudeRef, "W"), b.rationals(tagGPSLongitude, longitude...)}
+		}, true, -(52 + 31.0/60 + 12.34/3600), -(13 + 24.0/60 + 3.0/3600), 1.0 / 3600},
+		{"degrees only", func(b *tiffBuilder) []testTag {
+			return []testTag{b.ascii(tagGPSLatitudeRef, "N"), b.rationals(tagGPSLatitude, rational{5252, 100}, rational{0, 1}, rational{0, 1}),
+				b.ascii(tagGPSLongitudeRef, "E"), b.rationals(tagGPSLongitude, rational{1340, 100}, rational{0, 1}, rational{0, 1})}
+		}, true, 52.52, 13.4, 0.01},
+		{"missing latitude reference", func(b *tiffBuilder) []testTag {
+			return []testTag{b.rationals(tagGPSLatitude, latitude...),
+				b.ascii(tagGPSLongitudeRef, "E"), b.rationals(tagGPSLongitude, longitude...)}
+		}, false, 0, 0, 0},
+		{"missing longitude reference", func(b *tiffBuilder) []testTag {
+			return []testTag{b.ascii(tagGPSLatitudeRef, "N"), b.rationals(tagGPSLatitude, latitude...),
+				b.rationals(tagGPSLongitude, longitude...)}
+		}, false, 0, 0, 0},
+		{"unknown reference", func(b *tiffBuilder) []testTag {
+			return []testTag{b.ascii(tagGPSLatitudeRef, "E"), b.rationals(tagGPSLatitude, latitude...),
+				b.ascii(tagGPSLongitudeRef, "E"), b.rationals(tagGPSLongitude, longitude...)}
+		}, false, 0, 0, 0},
+		{"missing longitude", func(b *tiffBuilder) []testTag {
+			return []testTag{b.ascii(tagGPSLatitudeRef, "N"), b.rationals(tagGPSLatitude, latitude...),
+				b.ascii(tagGPSLongitudeRef, "E")}
+		}, false, 0, 0, 0},
+		{"two components", func(b *tiffBuilder) []testTag {
+			return []testTag{b.ascii(tagGPSLatitudeRef, "N"), b.rationals(tagGPSLatitude, latitude[:2]...),
+				b.ascii(tagGPSLongitudeRef, "E"), b.rationals(tagGPSLongitude, longitude...)}
+		}, false, 0, 0, 0},
+		{"zero denominator", func(b *tiffBuilder) []testTag {
+			return []testTag{b.ascii(tagGPSLatitudeRef, "N"), b.rationals(tagGPSLatitude, rational{52, 0}, rational{31, 1}, rational{12, 1}),
+				b.ascii(tagGPSLongitudeRef, "E"), b.rationals(tagGPSLongitude, longitude...)}
+		}, false, 0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTIFF(binary.LittleEndian)
+			gpsIFD := b.ifd(tt.tags(b)...)
+			b.setIFD0(b.ifd(b.long(tagGPSIFD, uint32(gpsIFD))))
+
+			info := parseExif(jpegWithExif(b.buf))
+			if info.HasGPS != tt.want {
+				t.Fatalf("HasGPS = %v, want %v", info.HasGPS, tt.want)
+			}
+			if !tt.want {
+				return
+			}
+			if math.Abs(info.Latitude-tt.lat) > 1e-9 || math.Abs(info.Longitude-tt.lon) > 1e-9 {
+				t.Errorf("position = %v, %v, want %v, %v", info.Latitude, info.Longitude, tt.lat, tt.lon)
+			}
+			if math.Abs(info.GPSResolution-tt.resolution) > 1e-12 {
+				t.Errorf("GPSResolution = %v, want %v", info.GPSResolution, tt.resolution)
+			}
+		})
+	}
+}
+
+// TestProcessKeepsLocationAside checks an upload hands back its GPS position while the stored photo loses it
+func TestProcessKeepsLocationAside(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, numbered(8, 8), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	taken := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	b := newTIFF(binary.BigEndian)
+	gpsIFD := b.ifd(
+		b.ascii(tagGPSLatitudeRef, "S"),
+		b.rationals(tagGPSLatitude, rational{33, 1}, rational{51, 1}, rational{3549, 100}),
+		b.ascii(tagGPSLongitudeRef, "E"),
+		b.rationals(tagGPSLongitude, rational{151, 1}, rational{12, 1}, rational{4000, 100}),
+		b.rationals(tagGPSTimeStamp, rational{uint32(taken.Hour()), 1}, rational{uint32(taken.Minute()), 1}, rational{uint32(taken.Second()), 1}),
+		b.ascii(tagGPSDateStamp, taken.Format("2006:01:02")),
+	)
+	b.setIFD0(b.ifd(b.long(tagGPSIFD, uint32(gpsIFD))))
+
+	img, err := Process(withExif(buf.Bytes(), b.buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Location == nil {
+		t.Fatal("no location was read from the upload")
+	}
+	if want := -(33 + 51.0/60 + 35.49/3600); math.Abs(img.Location.Latitude-want) > 1e-9 {
+		t.Errorf("Latitude = %v, want %v", img.Location.Latitude, want)
+	}
+	if !img.Location.CapturedAt.Equal(taken) {
+		t.Errorf("CapturedAt = %v, want %v", img.Location.CapturedAt, taken)
+	}
+	if info := parseExif(img.Data); info.HasGPS {
+		t.Error("the stored photo still carries its GPS position")
+	}
+}
@@ -0,0 +1,86 @@
+package middlewares
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"civicsync-be/config"
+	"civicsync-be/models"
+	authUtils "civicsync-be/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// APIKeyMiddleware authenticates requests carrying an X-API-Key header that grants the given scope.
+// Requests without the header pass through untouched so the following auth middleware can handle them.
+// Routes without this middleware never accept API keys.
+func APIKeyMiddleware(scope models.APIKeyScope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rawKey := c.GetHeader("X-API-Key")
+		if rawKey == "" {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var apiKey models.APIKey
+		err := config.GetCollection("api_keys").FindOne(ctx, bson.M{"keyHash": authUtils.HashAPIKey(rawKey)}).Decode(&apiKey)
+		if err != nil || !apiKey.IsActive() {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			c.Abort()
+			return
+		}
+
+		if !apiKey.HasScope(scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API key is missing the " + string(scope) + " scope"})
+			c.Abort()
+			return
+		}
+
+		// The key acts as its owner, so the owner's current role applies
+		var owner models.User
+		err = config.GetCollection("users").FindOne(ctx, bson.M{"_id": apiKey.User},
+			options.FindOne().SetProjection(bson.M{"role": 1}),
+		).Decode(&owner)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			c.Abort()
+			return
+		}
+
+		role := owner.Role
+		if !role.IsValid() {
+			role = models.RoleCitizen
+		}
+
+		// Record usage at most once a minute to avoid a write per request
+		now := time.Now()
+		_, err = config.GetCollection("api_keys").UpdateOne(ctx,
+			bson.M{"_id": apiKey.ID, "$or": []bson.M{
+				{"lastUsedAt": bson.M{"$exists": false}},
+				{"lastUsedAt": bson.M{"$lt": now.Add(-time.Minute)}},
+			}},
+			bson.M{"$set": bson.M{"lastUsedAt": now}},
+		)
+		if err != nil {
+			log.Println("Error recording API key usage:", err)
+		}
+
+		c.Set("user_id", apiKey.User.Hex())
+		c.Set("user_role", role)
+		c.Set("auth_method", authUtils.AuthMethodAPIKey)
+		c.Set("api_key_id", apiKey.ID.Hex())
+		c.Next()
+	}
+}
+
+// authenticatedByAPIKey reports whether APIKeyMiddleware already authenticated the request
+func authenticatedByAPIKey(c *gin.Context) bool {
+	return c.GetString("auth_method") == authUtils.AuthMethodAPIKey
+}
@@ -1,62 +1,156 @@
 package middlewares
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
+	"time"
+
+	"civicsync-be/models"
+	authUtils "civicsync-be/utils"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 )
 
-// AuthMiddleware validates JWT tokens and protects routes
+var errTokenRevoked = errors.New("token has been revoked")
+var errTokenStore = errors.New("token store unavailable")
+
+// AuthMiddleware validates JWT tokens and protects routes. Requests already authenticated by APIKeyMiddleware pass through.
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Get token from cookie
-		tokenString, err := c.Cookie("auth_token")
-		if err != nil || tokenString == "" {
+		if authenticatedByAPIKey(c) {
+			c.Next()
+			return
+		}
+
+		// Get token from the Authorization header or the cookie
+		tokenString, method := authUtils.AccessTokenFromRequest(c.Request)
+		if tokenString == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "No authorization token provided"})
 			c.Abort()
 			return
 		}
 
-		jwtSecret := os.Getenv("JWT_SECRET")
-		if jwtSecret == "" {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "JWT secret not configured"})
-			c.Abort()
+		claims, err := validateAccessToken(tokenString)
+		if err != nil {
+			abortWithTokenError(c, err)
 			return
 		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		setAuthContext(c, claims, method)
+		renewAccessToken(c, claims, method)
+		c.Next()
+	}
+}
 
-			if token.Method != jwt.SigningMethodHS256 {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(jwtSecret), nil
-		})
+// OptionalAuthMiddleware sets user_id when a valid auth token is present and lets anonymous requests through.
+// Expired or revoked tokens are treated as anonymous; tampered or malformed tokens are rejected.
+func OptionalAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if authenticatedByAPIKey(c) {
+			c.Next()
+			return
+		}
 
-		if err != nil || !token.Valid {
-			log.Printf("Token validation failed: %v", err)
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization token"})
-			c.Abort()
+		tokenString, method := authUtils.AccessTokenFromRequest(c.Request)
+		if tokenString == "" {
+			c.Next()
 			return
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			if userID, exists := claims["user_id"]; exists {
-				c.Set("user_id", userID)
-			} else {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
-				c.Abort()
+		claims, err := validateAccessToken(tokenString)
+		if err != nil {
+			if authUtils.IsTokenExpired(err) || errors.Is(err, errTokenRevoked) {
+				c.Next()
 				return
 			}
-		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
-			c.Abort()
+			abortWithTokenError(c, err)
 			return
 		}
 
+		setAuthContext(c, claims, method)
+		renewAccessToken(c, claims, method)
 		c.Next()
 	}
 }
+
+// validateAccessToken parses the token and checks it against the jti denylist and the session registry
+func validateAccessToken(tokenString string) (*authUtils.AccessClaims, error) {
+	claims, err := authUtils.ParseAccessToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := authUtils.IsAccessTokenRevoked(claims.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errTokenStore, err)
+	}
+	if revoked {
+		return nil, errTokenRevoked
+	}
+
+	active, err := authUtils.TouchSession(claims.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errTokenStore, err)
+	}
+	if !active {
+		return nil, errTokenRevoked
+	}
+
+	return claims, nil
+}
+
+// setAuthContext stores the authenticated identity on the request context
+func setAuthContext(c *gin.Context, claims *authUtils.AccessClaims, method string) {
+	c.Set("user_id", claims.UserID)
+	c.Set("auth_method", method)
+	c.Set("session_id", claims.SessionID)
+
+	role := models.Role(claims.Role)
+	if !role.IsValid() {
+		role = models.RoleCitizen
+	}
+	c.Set("user_role", role)
+	c.Set("token_claims", claims)
+}
+
+// renewAccessToken slides the session forward by issuing a fresh access token when the current one is about to expire.
+// Cookie clients get a new cookie, Bearer clients the token in the X-Renewed-Access-Token header.
+// The session's idle timeout and absolute lifetime still apply, since TouchSession enforces them on every request.
+func renewAccessToken(c *gin.Context, claims *authUtils.AccessClaims, method string) {
+	if time.Until(claims.ExpiresAt.Time) > authUtils.AccessTokenRenewalWindow {
+		return
+	}
+
+	accessToken, err := authUtils.GenerateAndSetToken(claims.UserID, claims.SessionID, models.Role(claims.Role))
+	if err != nil {
+		log.Printf("Access token renewal failed: %v", err)
+		return
+	}
+
+	if method == authUtils.AuthMethodBearer {
+		c.Header(authUtils.RenewedAccessTokenHeader, accessToken)
+		return
+	}
+	authUtils.SetAccessTokenCookie(c.Writer, accessToken)
+}
+
+// abortWithTokenError maps a validateAccessToken error to the matching response
+func abortWithTokenError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, authUtils.ErrSigningKeyMissing):
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "JWT signing keys not configured"})
+	case errors.Is(err, authUtils.ErrInvalidClaims):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+	case errors.Is(err, errTokenStore):
+		log.Printf("Token validation failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+	case errors.Is(err, errTokenRevoked):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization token has been revoked"})
+	default:
+		log.Printf("Token validation failed: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization token"})
+	}
+	c.Abort()
+}
@@ -12,15 +12,11 @@ import (
 
 func IssueRateLimiter(limit int) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userIDVal, _ := c.Get("user_id")
-		userID, ok := userIDVal.(string)
-		if !ok || userID == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user_id cookie missing"})
-			c.Abort()
+		userID, ok := rateLimitedUser(c)
+		if !ok {
 			return
 		}
 
-		ctx := config.Ctx
 		queuePrefix := os.Getenv("REDIS_QUEUE_FOR_ISSUE_LIMIT")
 		if queuePrefix == "" {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Redis queue not configured"})
@@ -29,37 +25,90 @@ func IssueRateLimiter(limit int) gin.HandlerFunc {
 		}
 
 		// Create individual key for each user
-		userKey := queuePrefix + ":" + userID
+		if !enforceUserLimit(c, queuePrefix+":"+userID, limit, 24*time.Hour) {
+			return
+		}
 
-		// Increment user's count with TTL
-		count, err := config.RedisClient.Incr(ctx, userKey).Result()
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error incrementing count"})
-			c.Abort()
+		c.Next()
+	}
+}
+
+// CommentRateLimiter caps how many comments a user can post per hour
+func CommentRateLimiter(limit int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := rateLimitedUser(c)
+		if !ok {
 			return
 		}
 
-		// Set TTL only for the first increment (when count = 1)
-		if count == 1 {
-			err = config.RedisClient.Expire(ctx, userKey, 24*time.Hour).Err()
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error setting TTL"})
-				c.Abort()
-				return
-			}
+		if !enforceUserLimit(c, "comment_rate:"+userID, limit, time.Hour) {
+			return
 		}
 
-		// Check if user exceeded limit
-		if count > int64(limit) {
-			retryAfter, _ := config.RedisClient.TTL(ctx, userKey).Result()
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error":       "rate limit exceeded",
-				"retry_after": retryAfter.Seconds(),
-			})
-			c.Abort()
+		c.Next()
+	}
+}
+
+// UploadRateLimiter caps how many photos a user can upload per hour
+func UploadRateLimiter(limit int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := rateLimitedUser(c)
+		if !ok {
+			return
+		}
+
+		if !enforceUserLimit(c, "upload_rate:"+userID, limit, time.Hour) {
 			return
 		}
 
 		c.Next()
 	}
 }
+
+// rateLimitedUser returns the authenticated user's ID, aborting the request when it is missing
+func rateLimitedUser(c *gin.Context) (string, bool) {
+	userIDVal, _ := c.Get("user_id")
+	userID, ok := userIDVal.(string)
+	if !ok || userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id cookie missing"})
+		c.Abort()
+		return "", false
+	}
+	return userID, true
+}
+
+// enforceUserLimit counts a request against userKey and aborts with 429 once limit is exceeded within window
+func enforceUserLimit(c *gin.Context, userKey string, limit int, window time.Duration) bool {
+	ctx := config.Ctx
+
+	// Increment user's count with TTL
+	count, err := config.RedisClient.Incr(ctx, userKey).Result()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error incrementing count"})
+		c.Abort()
+		return false
+	}
+
+	// Set TTL only for the first increment (when count = 1)
+	if count == 1 {
+		err = config.RedisClient.Expire(ctx, userKey, window).Err()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error setting TTL"})
+			c.Abort()
+			return false
+		}
+	}
+
+	// Check if user exceeded limit
+	if count > int64(limit) {
+		retryAfter, _ := config.RedisClient.TTL(ctx, userKey).Result()
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "rate limit exceeded",
+			"retry_after": retryAfter.Seconds(),
+		})
+		c.Abort()
+		return false
+	}
+
+	return true
+}
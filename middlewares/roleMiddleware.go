@@ -0,0 +1,32 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"civicsync-be/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole allows the request only if the user has one of the given roles. It must run after AuthMiddleware.
+func RequireRole(roles ...models.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roleVal, _ := c.Get("user_role")
+		role, ok := roleVal.(models.Role)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Abort()
+			return
+		}
+
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to perform this action"})
+		c.Abort()
+	}
+}
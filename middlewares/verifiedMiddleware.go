@@ -0,0 +1,56 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"civicsync-be/config"
+	"civicsync-be/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RequireVerified rejects users who have not verified their email address. It must run after AuthMiddleware.
+func RequireVerified() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDVal, _ := c.Get("user_id")
+		userID, ok := userIDVal.(string)
+		if !ok || userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Abort()
+			return
+		}
+
+		objectID, err := primitive.ObjectIDFromHex(userID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			c.Abort()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var user models.User
+		err = config.GetCollection("users").FindOne(ctx, bson.M{"_id": objectID},
+			options.FindOne().SetProjection(bson.M{"verified": 1}),
+		).Decode(&user)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			c.Abort()
+			return
+		}
+
+		if !user.Verified {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Please verify your email address first"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
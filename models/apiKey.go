@@ -0,0 +1,77 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// APIKeyScope enum
+type APIKeyScope string
+
+const (
+	ScopeIssuesRead    APIKeyScope = "issues:read"
+	ScopeIssuesWrite   APIKeyScope = "issues:write"
+	ScopeAnalyticsRead APIKeyScope = "analytics:read"
+)
+
+// IsValid reports whether s is one of the known scopes
+func (s APIKeyScope) IsValid() bool {
+	switch s {
+	case ScopeIssuesRead, ScopeIssuesWrite, ScopeAnalyticsRead:
+		return true
+	}
+	return false
+}
+
+// APIKey represents a long-lived credential for server-to-server integrations.
+// Requests made with a key act as the owning user, limited to the key's scopes.
+type APIKey struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name         string             `bson:"name" json:"name"`
+	Organization string             `bson:"organization,omitempty" json:"organization,omitempty"`
+	Prefix       string             `bson:"prefix" json:"prefix"`
+	KeyHash      string             `bson:"keyHash" json:"-"`
+	User         primitive.ObjectID `bson:"user" json:"user"`
+	Scopes       []APIKeyScope      `bson:"scopes" json:"scopes"`
+	ExpiresAt    *time.Time         `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	LastUsedAt   *time.Time         `bson:"lastUsedAt,omitempty" json:"lastUsedAt,omitempty"`
+	RevokedAt    *time.Time         `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// HasScope reports whether the key grants the given scope
+func (k *APIKey) HasScope(scope APIKeyScope) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsActive reports whether the key is neither revoked nor expired
+func (k *APIKey) IsActive() bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || time.Now().Before(*k.ExpiresAt)
+}
+
+// EnsureAPIKeyIndex creates a unique index on the key hash used for lookups
+func EnsureAPIKeyIndex(collection *mongo.Collection) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "keyHash", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+
+	_, err := collection.Indexes().CreateOne(ctx, indexModel)
+	return err
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UnattachedAssetTTL is how long an uploaded photo may wait to be attached to an issue before it is purged
+const UnattachedAssetTTL = 24 * time.Hour
+
+// PhotoLocation is where a photo was taken according to its EXIF GPS tags
+type PhotoLocation struct {
+	Latitude   float64   `bson:"latitude" json:"latitude"`
+	Longitude  float64   `bson:"longitude" json:"longitude"`
+	CapturedAt time.Time `bson:"capturedAt" json:"capturedAt"`
+}
+
+// Asset is an uploaded photo kept in the blob store, stripped of metadata, along with its thumbnail.
+// Issue is set once the photo is attached to an issue. Location comes from the EXIF GPS tags of the upload
+// and is only shown to the uploader, as a suggested issue location; it is removed once the photo is attached.
+type Asset struct {
+	ID           primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Owner        primitive.ObjectID  `bson:"owner" json:"owner"`
+	Issue        *primitive.ObjectID `bson:"issue,omitempty" json:"issue,omitempty"`
+	ContentType  string              `bson:"contentType" json:"contentType"`
+	Size         int64               `bson:"size" json:"size"`
+	Width        int                 `bson:"width" json:"width"`
+	Height       int                 `bson:"height" json:"height"`
+	Key          string              `bson:"key" json:"-"`
+	ThumbnailKey string              `bson:"thumbnailKey" json:"-"`
+	Location     *PhotoLocation      `bson:"location,omitempty" json:"-"`
+	CreatedAt    time.Time           `bson:"createdAt" json:"createdAt"`
+}
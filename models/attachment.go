@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxIssueAttachments is how many photos a single issue can carry
+const MaxIssueAttachments = 10
+
+// AttachmentKind enum
+type AttachmentKind string
+
+const (
+	// AttachmentReport photos document the problem as reported
+	AttachmentReport AttachmentKind = "report"
+	// AttachmentProgress photos show work under way
+	AttachmentProgress AttachmentKind = "progress"
+	// AttachmentResolution photos prove the problem was fixed
+	AttachmentResolution AttachmentKind = "resolution"
+)
+
+// IsValid reports whether k is one of the known attachment kinds
+func (k AttachmentKind) IsValid() bool {
+	switch k {
+	case AttachmentReport, AttachmentProgress, AttachmentResolution:
+		return true
+	}
+	return false
+}
+
+// RequiresOfficial reports whether only officials may attach photos of this kind
+func (k AttachmentKind) RequiresOfficial() bool {
+	return k == AttachmentProgress || k == AttachmentResolution
+}
+
+// Attachment is an uploaded photo shown on an issue, in ascending Order.
+// UploadedBy is never serialized, since it would reveal anonymous reporters; responses project it per viewer.
+type Attachment struct {
+	Asset      primitive.ObjectID `bson:"asset" json:"asset"`
+	Kind       AttachmentKind     `bson:"kind" json:"kind"`
+	UploadedBy primitive.ObjectID `bson:"uploadedBy" json:"-"`
+	Caption    string             `bson:"caption,omitempty" json:"caption,omitempty"`
+	Order      int                `bson:"order" json:"order"`
+	AddedAt    time.Time          `bson:"addedAt" json:"addedAt"`
+}
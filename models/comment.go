@@ -0,0 +1,38 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Comment is a remark on an issue; replies point at their parent comment.
+// Deleted comments keep their place in the thread but lose their body.
+type Comment struct {
+	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Issue     primitive.ObjectID  `bson:"issue" json:"issue"`
+	Author    primitive.ObjectID  `bson:"author" json:"author"`
+	Parent    *primitive.ObjectID `bson:"parent,omitempty" json:"parent,omitempty"`
+	Body      string              `bson:"body" json:"body"`
+	Deleted   bool                `bson:"deleted,omitempty" json:"deleted"`
+	EditedAt  *time.Time          `bson:"editedAt,omitempty" json:"editedAt,omitempty"`
+	DeletedAt *time.Time          `bson:"deletedAt,omitempty" json:"-"`
+	CreatedAt time.Time           `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time           `bson:"updatedAt" json:"updatedAt"`
+}
+
+// EnsureCommentIndex creates the index used to list the comments of an issue thread by thread
+func EnsureCommentIndex(collection *mongo.Collection) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	indexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: "issue", Value: 1}, {Key: "parent", Value: 1}, {Key: "createdAt", Value: 1}},
+	}
+
+	_, err := collection.Indexes().CreateOne(ctx, indexModel)
+	return err
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DataExportStatus enum
+type DataExportStatus string
+
+const (
+	ExportPending DataExportStatus = "pending"
+	ExportReady   DataExportStatus = "ready"
+	ExportFailed  DataExportStatus = "failed"
+)
+
+// DataExport tracks a personal data export archive generated in the background
+type DataExport struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	User      primitive.ObjectID `bson:"user" json:"user"`
+	Status    DataExportStatus   `bson:"status" json:"status"`
+	FilePath  string             `bson:"filePath,omitempty" json:"-"`
+	ExpiresAt *time.Time         `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
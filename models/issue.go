@@ -17,27 +17,47 @@ const (
 	Other       IssueCategory = "Other"
 )
 
-// IssueStatus enum
+// IssueStatus enum; the allowed transitions between statuses live in issueWorkflow.go
 type IssueStatus string
 
 const (
-	Pending    IssueStatus = "Pending"
-	InProgress IssueStatus = "In Progress"
-	Resolved   IssueStatus = "Resolved"
+	Pending      IssueStatus = "Pending"
+	Acknowledged IssueStatus = "Acknowledged"
+	InProgress   IssueStatus = "In Progress"
+	Resolved     IssueStatus = "Resolved"
+	Rejected     IssueStatus = "Rejected"
+	Duplicate    IssueStatus = "Duplicate"
 )
 
-// Issue represents a civic issue reported by a user
+// Issue represents a civic issue reported by a user.
+// ImageURL is only set on issues reported before photo uploads existed; newer issues carry uploaded photos as Attachments.
+// LocationFromPhoto is set while the coordinates come from the GPS tags of a photo rather than the reporter.
 type Issue struct {
-	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Title       string             `bson:"title" json:"title"`
-	Description string             `bson:"description" json:"description"`
-	Category    IssueCategory      `bson:"category" json:"category"`
-	Location    string             `bson:"location" json:"location"`
-	ImageURL    *string            `bson:"imageUrl,omitempty" json:"imageUrl,omitempty"`
-	Status      IssueStatus        `bson:"status" json:"status"`
-	CreatedBy   primitive.ObjectID `bson:"createdBy" json:"createdBy"`
-	Longitude   *float64           `bson:"longitude,omitempty" json:"longitude,omitempty"`
-	Latitude    *float64           `bson:"latitude,omitempty" json:"latitude,omitempty"`
-	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
-	UpdatedAt   time.Time          `bson:"updatedAt" json:"updatedAt"`
+	ID                primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Title             string             `bson:"title" json:"title"`
+	Description       string             `bson:"description" json:"description"`
+	Category          IssueCategory      `bson:"category" json:"category"`
+	Location          string             `bson:"location" json:"location"`
+	ImageURL          *string            `bson:"imageUrl,omitempty" json:"imageUrl,omitempty"`
+	Attachments       []Attachment       `bson:"attachments,omitempty" json:"attachments,omitempty"`
+	Status            IssueStatus        `bson:"status" json:"status"`
+	CreatedBy         primitive.ObjectID `bson:"createdBy" json:"createdBy"`
+	Longitude         *float64           `bson:"longitude,omitempty" json:"longitude,omitempty"`
+	Latitude          *float64           `bson:"latitude,omitempty" json:"latitude,omitempty"`
+	LocationFromPhoto bool               `bson:"locationFromPhoto,omitempty" json:"locationFromPhoto,omitempty"`
+	CreatedAt         time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt         time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// PlaceAtPhoto puts an issue reported without coordinates where its photo was taken, if the reporter confirmed
+// the location suggested on upload. It reports whether the issue was placed.
+func (i *Issue) PlaceAtPhoto(location *PhotoLocation, confirmed bool) bool {
+	if !confirmed || location == nil || i.Latitude != nil || i.Longitude != nil {
+		return false
+	}
+
+	latitude, longitude := location.Latitude, location.Longitude
+	i.Latitude, i.Longitude = &latitude, &longitude
+	i.LocationFromPhoto = true
+	return true
 }
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// statusRule describes one issue status. Adding a status means adding its constant and an entry here.
+type statusRule struct {
+	// Open statuses still need work and count as open issues
+	Open bool
+	// RequiresNote means moving into this status needs an explanation for the reporter
+	RequiresNote bool
+	// Next lists the statuses an issue in this status may move to
+	Next []IssueStatus
+}
+
+var issueWorkflow = map[IssueStatus]statusRule{
+	Pending: {
+		Open: true,
+		Next: []IssueStatus{Acknowledged, InProgress, Resolved, Rejected, Duplicate},
+	},
+	Acknowledged: {
+		Open: true,
+		Next: []IssueStatus{InProgress, Resolved, Rejected, Duplicate},
+	},
+	InProgress: {
+		Open: true,
+		Next: []IssueStatus{Acknowledged, Resolved},
+	},
+	Resolved: {
+		RequiresNote: true,
+		// Reopening when the fix did not hold
+		Next: []IssueStatus{InProgress},
+	},
+	Rejected: {
+		RequiresNote: true,
+		Next:         []IssueStatus{Pending},
+	},
+	Duplicate: {
+		RequiresNote: true,
+		Next:         []IssueStatus{Pending},
+	},
+}
+
+// IsValid reports whether s is one of the known statuses
+func (s IssueStatus) IsValid() bool {
+	_, ok := issueWorkflow[s]
+	return ok
+}
+
+// IsOpen reports whether issues in this status still need work
+func (s IssueStatus) IsOpen() bool {
+	return issueWorkflow[s].Open
+}
+
+// RequiresNote reports whether moving an issue into this status needs a note
+func (s IssueStatus) RequiresNote() bool {
+	return issueWorkflow[s].RequiresNote
+}
+
+// CanTransitionTo reports whether an issue may move from s to next
+func (s IssueStatus) CanTransitionTo(next IssueStatus) bool {
+	for _, allowed := range issueWorkflow[s].Next {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenIssueStatuses returns every status that counts as open
+func OpenIssueStatuses() []IssueStatus {
+	var open []IssueStatus
+	for status, rule := range issueWorkflow {
+		if rule.Open {
+			open = append(open, status)
+		}
+	}
+	return open
+}
+
+// IssueStatusChange is a timeline entry recording who moved an issue between statuses and why.
+// From is empty for the entry written when the issue is created.
+type IssueStatusChange struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Issue     primitive.ObjectID `bson:"issue" json:"issue"`
+	Actor     primitive.ObjectID `bson:"actor" json:"actor"`
+	From      IssueStatus        `bson:"from,omitempty" json:"from,omitempty"`
+	To        IssueStatus        `bson:"to" json:"to"`
+	Note      string             `bson:"note,omitempty" json:"note,omitempty"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlaceAtPhoto(t *testing.T) {
+	photo := &PhotoLocation{Latitude: 52.52, Longitude: 13.405, CapturedAt: time.Now()}
+	given := 48.85
+
+	tests := []struct {
+		name      string
+		issue     Issue
+		location  *PhotoLocation
+		confirmed bool
+		placed    bool
+	}{
+		{"confirmed", Issue{}, photo, true, true},
+		{"not confirmed", Issue{}, photo, false, false},
+		{"photo without a location", Issue{}, nil, true, false},
+		{"reporter gave coordinates", Issue{Latitude: &given, Longitude: &given}, photo, true, false},
+		{"reporter gave a latitude only", Issue{Latitude: &given}, photo, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issue := tt.issue
+			if placed := issue.PlaceAtPhoto(tt.location, tt.confirmed); placed != tt.placed {
+				t.Fatalf("PlaceAtPhoto() = %v, want %v", placed, tt.placed)
+			}
+			if issue.LocationFromPhoto != tt.placed {
+				t.Errorf("LocationFromPhoto = %v, want %v", issue.LocationFromPhoto, tt.placed)
+			}
+
+			if !tt.placed {
+				if issue.Latitude != tt.issue.Latitude || issue.Longitude != tt.issue.Longitude {
+					t.Errorf("coordinates changed to %v, %v", issue.Latitude, issue.Longitude)
+				}
+				return
+			}
+			if issue.Latitude == nil || *issue.Latitude != photo.Latitude || issue.Longitude == nil || *issue.Longitude != photo.Longitude {
+				t.Fatalf("coordinates = %v, %v, want the photo's", issue.Latitude, issue.Longitude)
+			}
+			// The issue keeps its own copy, unaffected by later changes to the asset's location
+			if issue.Latitude == &tt.location.Latitude {
+				t.Error("issue shares the latitude of the photo location")
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LoginLockout records an account or IP being locked out after repeated failed logins
+type LoginLockout struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Scope       string             `bson:"scope" json:"scope"`
+	Subject     string             `bson:"subject" json:"subject"`
+	IP          string             `bson:"ip" json:"ip"`
+	Failures    int64              `bson:"failures" json:"failures"`
+	LockedUntil time.Time          `bson:"lockedUntil" json:"lockedUntil"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+}
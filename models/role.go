@@ -0,0 +1,35 @@
+package models
+
+// Role enum
+type Role string
+
+const (
+	RoleCitizen   Role = "citizen"
+	RoleOfficial  Role = "official"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// IsValid reports whether r is one of the known roles
+func (r Role) IsValid() bool {
+	switch r {
+	case RoleCitizen, RoleOfficial, RoleModerator, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+// CanChangeIssueStatus reports whether the role may move issues between statuses
+func (r Role) CanChangeIssueStatus() bool {
+	return r == RoleOfficial || r == RoleAdmin
+}
+
+// CanModerateIssues reports whether the role may edit or delete issues, and delete comments, created by other users
+func (r Role) CanModerateIssues() bool {
+	return r == RoleModerator || r == RoleAdmin
+}
+
+// CanViewReporterContact reports whether the role may see the email address of issue reporters
+func (r Role) CanViewReporterContact() bool {
+	return r == RoleOfficial || r == RoleModerator || r == RoleAdmin
+}
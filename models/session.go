@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Session represents a logged-in device; it lives in Redis rather than MongoDB
+type Session struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"-"`
+	Device    string    `json:"device"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"userAgent"`
+	CreatedAt time.Time `json:"createdAt"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Current   bool      `json:"current"`
+}
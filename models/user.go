@@ -1,20 +1,94 @@
 package models
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // User represents a user in the system
 type User struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Name      string             `bson:"name" json:"name"`
-	Email     string             `bson:"email" json:"email"`
-	Password  string             `bson:"password,omitempty" json:"-"` 
-	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
-	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
+	ID                  primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name                string             `bson:"name" json:"name"`
+	Email               string             `bson:"email" json:"email"`
+	Password            string             `bson:"password,omitempty" json:"-"`
+	Verified            bool               `bson:"verified" json:"verified"`
+	Role                Role               `bson:"role" json:"role"`
+	AvatarURL           string             `bson:"avatarUrl,omitempty" json:"avatarUrl,omitempty"`
+	ReportAnonymously   bool               `bson:"reportAnonymously,omitempty" json:"reportAnonymously"`
+	PasswordlessLogin   bool               `bson:"passwordlessLogin,omitempty" json:"passwordlessLogin"`
+	TwoFactorEnabled    bool               `bson:"twoFactorEnabled,omitempty" json:"twoFactorEnabled"`
+	TwoFactorRequired   bool               `bson:"twoFactorRequired,omitempty" json:"twoFactorRequired"`
+	TwoFactorSecret     string             `bson:"twoFactorSecret,omitempty" json:"-"`
+	PendingTOTPSecret   string             `bson:"pendingTotpSecret,omitempty" json:"-"`
+	RecoveryCodes       []string           `bson:"recoveryCodes,omitempty" json:"-"`
+	Identities          []ExternalIdentity `bson:"identities,omitempty" json:"identities,omitempty"`
+	DeletionScheduledAt *time.Time         `bson:"deletionScheduledAt,omitempty" json:"deletionScheduledAt,omitempty"`
+	Deleted             bool               `bson:"deleted,omitempty" json:"-"`
+	DeletedAt           *time.Time         `bson:"deletedAt,omitempty" json:"-"`
+	CreatedAt           time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt           time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// ExternalIdentity links a user to an account at an OpenID Connect provider
+type ExternalIdentity struct {
+	Provider string    `bson:"provider" json:"provider"`
+	Subject  string    `bson:"subject" json:"-"`
+	Email    string    `bson:"email" json:"email"`
+	LinkedAt time.Time `bson:"linkedAt" json:"linkedAt"`
+}
+
+// DeletedUserName is shown in place of the name of a deleted account
+const DeletedUserName = "Deleted user"
+
+// AnonymousUserName is shown in place of the name of a user who reports anonymously
+const AnonymousUserName = "Anonymous"
+
+// AccountDeletionGracePeriod is how long a deletion request can still be cancelled
+const AccountDeletionGracePeriod = 14 * 24 * time.Hour
+
+// PublicUser is the view of a user shown to other people.
+// Email is only filled in for the user themself and for staff allowed to contact reporters.
+type PublicUser struct {
+	ID         *primitive.ObjectID `json:"id,omitempty"`
+	Name       string              `json:"name"`
+	AvatarURL  string              `json:"avatarUrl,omitempty"`
+	Reputation int64               `json:"reputation"`
+	ProfileURL string              `json:"profileUrl,omitempty"`
+	Email      string              `json:"email,omitempty"`
+}
+
+// Public returns the public projection of the user; anonymous and deleted users keep only a display name
+func (u *User) Public(reputation int64) PublicUser {
+	switch {
+	case u.Deleted:
+		return PublicUser{Name: DeletedUserName}
+	case u.ReportAnonymously:
+		return PublicUser{Name: AnonymousUserName}
+	}
+
+	id := u.ID
+	return PublicUser{
+		ID:         &id,
+		Name:       u.Name,
+		AvatarURL:  u.AvatarURL,
+		Reputation: reputation,
+		ProfileURL: "/api/users/" + u.ID.Hex(),
+	}
+}
+
+// NormalizeEmail trims and lowercases an email address so that lookups and the unique index ignore case
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
 
 // HashPassword hashes the user's password before storing it
@@ -32,3 +106,127 @@ func (u *User) ComparePassword(candidate string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(candidate))
 	return err == nil
 }
+
+// BackfillUserDefaults fills fields added after launch on existing users:
+// accounts created before email verification existed count as verified, users without a role are citizens
+// and emails are normalized
+func BackfillUserDefaults(collection *mongo.Collection) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.UpdateMany(ctx,
+		bson.M{"verified": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"verified": true}},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = collection.UpdateMany(ctx,
+		bson.M{"role": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"role": RoleCitizen}},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Emails were stored as typed before normalization was added. Accounts whose emails only differ
+	// in case would become indistinguishable, so they are reported and have to be merged by hand first.
+	collisions, err := FindEmailCollisions(collection)
+	if err != nil {
+		return err
+	}
+	if len(collisions) > 0 {
+		for _, collision := range collisions {
+			log.Printf("Accounts %v share the email %s once normalized", collision.UserIDs, collision.Email)
+		}
+		return ErrEmailCollisions
+	}
+
+	_, err = collection.UpdateMany(ctx,
+		bson.M{"email": bson.M{"$regex": `[A-Z]|^\s|\s$`}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"email": bson.M{"$toLower": bson.M{"$trim": bson.M{"input": "$email"}}}}}}},
+	)
+	return err
+}
+
+// ErrEmailCollisions is returned while several accounts share an email once it is normalized
+var ErrEmailCollisions = errors.New("several accounts share an email once normalized; merge them before starting")
+
+// EmailCollision lists accounts whose emails only differ in case or surrounding whitespace
+type EmailCollision struct {
+	Email   string               `bson:"_id"`
+	UserIDs []primitive.ObjectID `bson:"users"`
+}
+
+// FindEmailCollisions returns the groups of accounts that would share an email once normalized
+func FindEmailCollisions(collection *mongo.Collection) ([]EmailCollision, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"$toLower": bson.M{"$trim": bson.M{"input": "$email"}}},
+			"users": bson.M{"$push": "$_id"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("finding email collisions: %w", err)
+	}
+
+	var collisions []EmailCollision
+	if err := cursor.All(ctx, &collisions); err != nil {
+		return nil, err
+	}
+	return collisions, nil
+}
+
+// PromoteBootstrapAdmin makes the verified account with the given email an admin, so a fresh deployment
+// has someone who can grant roles. It reports whether such an account exists.
+// Requiring a verified address stops whoever registers the email first from claiming the role.
+func PromoteBootstrapAdmin(collection *mongo.Collection, email string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := collection.UpdateOne(ctx,
+		bson.M{"email": NormalizeEmail(email), "verified": true, "deleted": bson.M{"$ne": true}},
+		bson.M{"$set": bson.M{"role": RoleAdmin}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// EnsureUserEmailIndex creates a unique index on the normalized email.
+// It fails if existing accounts differ only in the case of their email; those have to be merged by hand.
+func EnsureUserEmailIndex(collection *mongo.Collection) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+
+	_, err := collection.Indexes().CreateOne(ctx, indexModel)
+	return err
+}
+
+// EnsureUserIdentityIndex creates a unique index so a provider account can be linked to only one user
+func EnsureUserIdentityIndex(collection *mongo.Collection) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	indexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: "identities.provider", Value: 1}, {Key: "identities.subject", Value: 1}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+			"identities.provider": bson.M{"$exists": true},
+		}),
+	}
+
+	_, err := collection.Indexes().CreateOne(ctx, indexModel)
+	return err
+}
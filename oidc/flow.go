@@ -0,0 +1,197 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"civicsync-be/config"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Users have this long to finish signing in at the provider
+const LoginStateTTL = 10 * time.Minute
+
+const loginStatePrefix = "oidc_state:"
+
+// ErrInvalidState is returned when the state of a callback is unknown, expired or already used
+var ErrInvalidState = errors.New("OIDC login state is invalid or expired")
+
+// stateStore keeps login states between the redirect to the provider and its callback
+type stateStore interface {
+	Save(key string, data []byte, ttl time.Duration) error
+	// Take returns and deletes a state, or ErrInvalidState when it is unknown or expired
+	Take(key string) ([]byte, error)
+}
+
+// redisStateStore keeps login states in Redis so any instance of the API can handle the callback
+type redisStateStore struct{}
+
+func (redisStateStore) Save(key string, data []byte, ttl time.Duration) error {
+	return config.RedisClient.Set(config.Ctx, loginStatePrefix+key, data, ttl).Err()
+}
+
+func (redisStateStore) Take(key string) ([]byte, error) {
+	// GETDEL makes the state single-use
+	data, err := config.RedisClient.GetDel(config.Ctx, loginStatePrefix+key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrInvalidState
+	}
+	return data, err
+}
+
+var states stateStore = redisStateStore{}
+
+// loginState is what we remember between the redirect to the provider and its callback
+type loginState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"codeVerifier"`
+}
+
+// AuthCodeURL starts an authorization-code flow with PKCE and returns the provider URL to send the browser to,
+// along with the state. The caller binds the state to the browser, see StateBinding.
+func (p *Provider) AuthCodeURL(ctx context.Context) (authURL, state string, err error) {
+	doc, err := p.metadata(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err = randomString()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+
+	data, err := json.Marshal(loginState{Provider: p.Name, Nonce: nonce, CodeVerifier: verifier})
+	if err != nil {
+		return "", "", err
+	}
+	if err := states.Save(state, data, LoginStateTTL); err != nil {
+		return "", "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.ClientID)
+	params.Set("redirect_uri", p.RedirectURL)
+	params.Set("scope", strings.Join(p.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return doc.AuthorizationEndpoint + separator + params.Encode(), state, nil
+}
+
+// StateBinding returns the value the browser that started a login keeps in a cookie. Only a hash of the
+// state is stored there, and a callback whose state does not match it was not started by that browser.
+func StateBinding(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
+
+// HandleCallback redeems the state and authorization code of a callback and returns the validated ID token claims.
+// binding is the StateBinding kept by the browser; callbacks from another browser are rejected (login CSRF).
+func (p *Provider) HandleCallback(ctx context.Context, state, binding, code string) (*IDTokenClaims, error) {
+	if state == "" || code == "" {
+		return nil, ErrInvalidState
+	}
+	if subtle.ConstantTimeCompare([]byte(binding), []byte(StateBinding(state))) != 1 {
+		return nil, ErrInvalidState
+	}
+
+	data, err := states.Take(state)
+	if err != nil {
+		return nil, err
+	}
+
+	var saved loginState
+	if err := json.Unmarshal(data, &saved); err != nil || saved.Provider != p.Name {
+		return nil, ErrInvalidState
+	}
+
+	rawIDToken, err := p.exchangeCode(ctx, code, saved.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.VerifyIDToken(ctx, rawIDToken, saved.Nonce)
+}
+
+// exchangeCode trades the authorization code for tokens at the token endpoint and returns the ID token
+func (p *Provider) exchangeCode(ctx context.Context, code, verifier string) (string, error) {
+	doc, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("code_verifier", verifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("decoding token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || body.Error != "" {
+		return "", fmt.Errorf("token endpoint returned %s: %s %s", resp.Status, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return "", errors.New("token response has no id_token")
+	}
+
+	return body.IDToken, nil
+}
+
+// randomString returns 32 random bytes, base64url encoded
+func randomString() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,232 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestLoginFlowUsesPKCE(t *testing.T) {
+	useMemoryStates(t)
+	idp := newTestIdP(t)
+	idp.claims["email"] = "Jane@Example.com"
+	idp.claims["email_verified"] = true
+	provider := idp.provider(false)
+	ctx := context.Background()
+
+	authURL, state, err := provider.AuthCodeURL(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params, err := url.ParseQuery(mustParseURL(t, authURL).RawQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Get("code_challenge_method") != "S256" || params.Get("code_challenge") == "" {
+		t.Fatalf("authorization URL has no S256 code challenge: %s", authURL)
+	}
+	if params.Get("state") != state || params.Get("nonce") == "" {
+		t.Fatalf("authorization URL has the wrong state or no nonce: %s", authURL)
+	}
+
+	returnedState, code := idp.login(t, authURL)
+	if returnedState != state {
+		t.Fatalf("provider returned state %q, want %q", returnedState, state)
+	}
+
+	claims, err := provider.HandleCallback(ctx, state, StateBinding(state), code)
+	if err != nil {
+		t.Fatalf("HandleCallback: %v", err)
+	}
+	if claims.Subject != "user-1" || claims.Email != "Jane@Example.com" || !claims.IsEmailVerified() {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+
+	// The state and the code are single-use
+	if _, err := provider.HandleCallback(ctx, state, StateBinding(state), code); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("reusing the state: got %v, want ErrInvalidState", err)
+	}
+}
+
+func TestTokenEndpointRejectsWrongCodeVerifier(t *testing.T) {
+	useMemoryStates(t)
+	idp := newTestIdP(t)
+	provider := idp.provider(false)
+	ctx := context.Background()
+
+	authURL, _, err := provider.AuthCodeURL(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, code := idp.login(t, authURL)
+
+	if _, err := provider.exchangeCode(ctx, code, "not-the-verifier"); err == nil {
+		t.Fatal("code was redeemed with the wrong PKCE verifier")
+	}
+}
+
+func TestCallbackRejectsStateFromAnotherBrowser(t *testing.T) {
+	useMemoryStates(t)
+	idp := newTestIdP(t)
+	provider := idp.provider(false)
+	ctx := context.Background()
+
+	// The attacker starts a login and hands the callback URL to the victim, whose browser has no binding
+	authURL, state, err := provider.AuthCodeURL(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, code := idp.login(t, authURL)
+
+	_, otherState, err := provider.AuthCodeURL(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, binding := range map[string]string{
+		"missing cookie":     "",
+		"other login":        StateBinding(otherState),
+		"raw state as value": state,
+	} {
+		if _, err := provider.HandleCallback(ctx, state, binding, code); !errors.Is(err, ErrInvalidState) {
+			t.Errorf("%s: got %v, want ErrInvalidState", name, err)
+		}
+	}
+
+	// A rejected callback does not burn the state of the browser that started the login
+	if _, err := provider.HandleCallback(ctx, state, StateBinding(state), code); err != nil {
+		t.Fatalf("callback from the right browser: %v", err)
+	}
+}
+
+func TestCallbackRejectsStateOfAnotherProvider(t *testing.T) {
+	useMemoryStates(t)
+	idp := newTestIdP(t)
+	provider := idp.provider(false)
+	other := idp.provider(false)
+	other.Name = "other"
+	ctx := context.Background()
+
+	authURL, state, err := provider.AuthCodeURL(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, code := idp.login(t, authURL)
+
+	if _, err := other.HandleCallback(ctx, state, StateBinding(state), code); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("got %v, want ErrInvalidState", err)
+	}
+}
+
+func TestVerifyIDTokenChecksClaims(t *testing.T) {
+	idp := newTestIdP(t)
+	provider := idp.provider(false)
+	ctx := context.Background()
+	const nonce = "expected-nonce"
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		valid  bool
+	}{
+		{"valid", jwt.MapClaims{"nonce": nonce}, true},
+		{"wrong nonce", jwt.MapClaims{"nonce": "other-nonce"}, false},
+		{"missing nonce", jwt.MapClaims{}, false},
+		{"wrong issuer", jwt.MapClaims{"nonce": nonce, "iss": "https://evil.example.test"}, false},
+		{"wrong audience", jwt.MapClaims{"nonce": nonce, "aud": "other-client"}, false},
+		{"several audiences without azp", jwt.MapClaims{"nonce": nonce, "aud": []string{testClientID, "other-client"}}, false},
+		{"several audiences issued to another client", jwt.MapClaims{"nonce": nonce, "aud": []string{testClientID, "other-client"}, "azp": "other-client"}, false},
+		{"several audiences issued to us", jwt.MapClaims{"nonce": nonce, "aud": []string{testClientID, "other-client"}, "azp": testClientID}, true},
+		{"expired", jwt.MapClaims{"nonce": nonce, "exp": time.Now().Add(-time.Hour).Unix()}, false},
+		{"missing subject", jwt.MapClaims{"nonce": nonce, "sub": ""}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := idp.sign(tt.claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = provider.VerifyIDToken(ctx, raw, nonce)
+			if tt.valid && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidIDToken) {
+				t.Fatalf("got %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenRejectsForeignSignature(t *testing.T) {
+	idp := newTestIdP(t)
+	impostor := newTestIdP(t)
+	impostor.claims["iss"] = idp.URL
+	ctx := context.Background()
+
+	raw, err := impostor.sign(jwt.MapClaims{"nonce": "n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := idp.provider(false).VerifyIDToken(ctx, raw, "n"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("got %v, want ErrInvalidIDToken", err)
+	}
+}
+
+// TestLinkingEmail signs in end to end and checks which email the callback may match or link accounts by
+func TestLinkingEmail(t *testing.T) {
+	tests := []struct {
+		name       string
+		verified   interface{}
+		trustEmail bool
+		want       string
+	}{
+		{"verified", true, false, "jane@example.com"},
+		{"verified as a string", "true", false, "jane@example.com"},
+		{"unverified", false, false, ""},
+		// Microsoft sends no email_verified claim at all
+		{"no claim", nil, false, ""},
+		{"no claim from a trusted provider", nil, true, "jane@example.com"},
+		{"unverified from a trusted provider", false, true, "jane@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useMemoryStates(t)
+			idp := newTestIdP(t)
+			idp.claims["email"] = "jane@example.com"
+			if tt.verified != nil {
+				idp.claims["email_verified"] = tt.verified
+			}
+			provider := idp.provider(tt.trustEmail)
+			ctx := context.Background()
+
+			authURL, _, err := provider.AuthCodeURL(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			state, code := idp.login(t, authURL)
+			claims, err := provider.HandleCallback(ctx, state, StateBinding(state), code)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := provider.TrustedEmail(claims); got != tt.want {
+				t.Fatalf("TrustedEmail() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func mustParseURL(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
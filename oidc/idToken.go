@@ -0,0 +1,197 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidIDToken is returned for ID tokens that fail signature or claim validation
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+// IDTokenClaims are the ID token claims we use
+type IDTokenClaims struct {
+	Email         string      `json:"email"`
+	EmailVerified interface{} `json:"email_verified"`
+	Name          string      `json:"name"`
+	Nonce         string      `json:"nonce"`
+	// azp names the client the token was issued to when it has several audiences
+	AuthorizedParty string `json:"azp"`
+	jwt.RegisteredClaims
+}
+
+// IsEmailVerified reports whether the provider vouches for the email; some providers send the flag as a string
+func (c *IDTokenClaims) IsEmailVerified() bool {
+	switch v := c.EmailVerified.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// TrustedEmail returns the email of the token when the provider vouches for it, either with the email_verified
+// claim or because it is configured with TrustEmail, and "" otherwise
+func (p *Provider) TrustedEmail(claims *IDTokenClaims) string {
+	if !claims.IsEmailVerified() && !p.TrustEmail {
+		return ""
+	}
+	return claims.Email
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce of an ID token
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*IDTokenClaims, error) {
+	claims := &IDTokenClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.verificationKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if claims.Nonce == "" || claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+	// With several audiences the token must have been issued to us
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.ClientID {
+		return nil, fmt.Errorf("%w: authorized party mismatch", ErrInvalidIDToken)
+	}
+
+	return claims, nil
+}
+
+// verificationKey returns the provider key with the given kid, refetching the JWKS once if it is unknown (rotation)
+func (p *Provider) verificationKey(ctx context.Context, kid string) (interface{}, error) {
+	doc, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	keys, err := fetchJWKS(ctx, doc.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	// Providers with a single key sometimes omit kid
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// jsonWebKey is a public key from a JWKS
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// fetchJWKS downloads a JWKS and returns its RSA and EC signing keys by kid
+func fetchJWKS(ctx context.Context, jwksURI string) (map[string]interface{}, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, jwksURI, &set); err != nil {
+		return nil, fmt.Errorf("fetching JWKS: %w", err)
+	}
+
+	keys := make(map[string]interface{})
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+// publicKey converts the JWK to an *rsa.PublicKey or *ecdsa.PublicKey
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
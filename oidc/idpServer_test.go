@@ -0,0 +1,242 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID     = "civicsync-test"
+	testClientSecret = "s3cret/with+symbols"
+	testKeyID        = "test-key"
+	testRedirectURL  = "https://api.example.test/api/auth/oidc/mock/callback"
+)
+
+// testIdP is a minimal OpenID Connect provider with discovery, JWKS, authorization and token endpoints
+type testIdP struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authorization
+	// claims are added to every ID token, and may override the standard ones
+	claims jwt.MapClaims
+}
+
+// authorization is what the provider remembers about an authorization code
+type authorization struct {
+	challenge   string
+	nonce       string
+	redirectURI string
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &testIdP{key: key, codes: make(map[string]authorization), claims: jwt.MapClaims{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/jwks", idp.jwks)
+	mux.HandleFunc("/authorize", idp.authorize)
+	mux.HandleFunc("/token", idp.token)
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+
+	return idp
+}
+
+// provider returns a Provider configured for the test IdP
+func (idp *testIdP) provider(trustEmail bool) *Provider {
+	return &Provider{
+		Name:         "mock",
+		Issuer:       idp.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		Scopes:       []string{"openid", "email", "profile"},
+		RedirectURL:  testRedirectURL,
+		TrustEmail:   trustEmail,
+	}
+}
+
+func (idp *testIdP) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 idp.URL,
+		"authorization_endpoint": idp.URL + "/authorize",
+		"token_endpoint":         idp.URL + "/token",
+		"jwks_uri":               idp.URL + "/jwks",
+	})
+}
+
+func (idp *testIdP) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": testKeyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize signs the user in right away and redirects back with a code, as a browser would see it
+func (idp *testIdP) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("response_type") != "code" || q.Get("client_id") != testClientID || q.Get("redirect_uri") != testRedirectURL {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	code := rand.Text()
+	idp.mu.Lock()
+	idp.codes[code] = authorization{
+		challenge:   q.Get("code_challenge"),
+		nonce:       q.Get("nonce"),
+		redirectURI: q.Get("redirect_uri"),
+	}
+	idp.mu.Unlock()
+
+	back := url.Values{"code": {code}, "state": {q.Get("state")}}
+	http.Redirect(w, r, q.Get("redirect_uri")+"?"+back.Encode(), http.StatusFound)
+}
+
+// token redeems a code once, checking the client credentials and the PKCE verifier
+func (idp *testIdP) token(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	clientID, _ = url.QueryUnescape(clientID)
+	clientSecret, _ = url.QueryUnescape(clientSecret)
+	if !ok || clientID != testClientID || clientSecret != testClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	idp.mu.Lock()
+	auth, found := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !found || auth.redirectURI != r.PostForm.Get("redirect_uri") ||
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != auth.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken, err := idp.sign(jwt.MapClaims{"nonce": auth.nonce})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"id_token": idToken, "token_type": "Bearer"})
+}
+
+// sign issues an ID token for the user "user-1" with the given claims on top of the IdP's claims
+func (idp *testIdP) sign(extra jwt.MapClaims) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss": idp.URL,
+		"sub": "user-1",
+		"aud": testClientID,
+		"iat": now.Unix(),
+		"exp": now.Add(5 * time.Minute).Unix(),
+	}
+	idp.mu.Lock()
+	for name, value := range idp.claims {
+		claims[name] = value
+	}
+	idp.mu.Unlock()
+	for name, value := range extra {
+		claims[name] = value
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = testKeyID
+	return token.SignedString(idp.key)
+}
+
+// login runs the browser's part of a sign-in: it follows the authorization URL to the provider and
+// returns the state and code the provider sends back to the callback
+func (idp *testIdP) login(t *testing.T, authURL string) (state, code string) {
+	t.Helper()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorization endpoint returned %s", resp.Status)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location.Query().Get("state"), location.Query().Get("code")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// memoryStateStore replaces Redis in tests
+type memoryStateStore struct {
+	mu     sync.Mutex
+	states map[string][]byte
+}
+
+func (s *memoryStateStore) Save(key string, data []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[key] = data
+	return nil
+}
+
+func (s *memoryStateStore) Take(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.states[key]
+	if !ok {
+		return nil, ErrInvalidState
+	}
+	delete(s.states, key)
+	return data, nil
+}
+
+// useMemoryStates swaps the Redis state store for an in-memory one for the duration of the test
+func useMemoryStates(t *testing.T) {
+	previous := states
+	states = &memoryStateStore{states: make(map[string][]byte)}
+	t.Cleanup(func() { states = previous })
+}
@@ -0,0 +1,167 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Provider metadata is re-fetched after this long so endpoint and key changes are picked up
+const discoveryTTL = time.Hour
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// ErrUnknownProvider is returned for provider names that are not configured
+var ErrUnknownProvider = errors.New("unknown OIDC provider")
+
+// Provider is an OpenID Connect identity provider we accept logins from
+type Provider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	RedirectURL  string
+	// TrustEmail accepts the provider's emails without an email_verified claim and links them to existing
+	// accounts automatically. Only set it for providers that own the email domains they sign in.
+	TrustEmail bool
+
+	mu           sync.Mutex
+	discovery    *discoveryDocument
+	discoveredAt time.Time
+	keys         map[string]interface{}
+}
+
+// discoveryDocument is the part of /.well-known/openid-configuration we use
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+var (
+	providers     map[string]*Provider
+	providersOnce sync.Once
+)
+
+// Providers returns the configured providers keyed by name.
+//
+// OIDC_PROVIDERS lists the provider names, e.g. "google,microsoft,state". Each name needs
+// OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID and OIDC_<NAME>_CLIENT_SECRET; OIDC_<NAME>_SCOPES is optional.
+// OIDC_<NAME>_TRUST_EMAIL=true sets Provider.TrustEmail; without it the owner of an existing account with
+// the same email has to confirm the link while signed in.
+// The redirect URL is OIDC_REDIRECT_BASE_URL followed by /api/auth/oidc/<name>/callback.
+func Providers() map[string]*Provider {
+	providersOnce.Do(func() {
+		providers = loadProviders()
+	})
+	return providers
+}
+
+// Names returns the configured provider names in a stable order
+func Names() []string {
+	names := make([]string, 0, len(Providers()))
+	for name := range Providers() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the provider with the given name
+func Get(name string) (*Provider, error) {
+	provider, ok := Providers()[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return provider, nil
+}
+
+func loadProviders() map[string]*Provider {
+	loaded := make(map[string]*Provider)
+	redirectBase := strings.TrimSuffix(os.Getenv("OIDC_REDIRECT_BASE_URL"), "/")
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider := &Provider{
+			Name:         name,
+			Issuer:       strings.TrimSuffix(os.Getenv(prefix+"ISSUER"), "/"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			Scopes:       []string{"openid", "email", "profile"},
+			RedirectURL:  redirectBase + "/api/auth/oidc/" + name + "/callback",
+			TrustEmail:   os.Getenv(prefix+"TRUST_EMAIL") == "true",
+		}
+		if scopes := os.Getenv(prefix + "SCOPES"); scopes != "" {
+			provider.Scopes = strings.Fields(strings.ReplaceAll(scopes, ",", " "))
+		}
+
+		if provider.Issuer == "" || provider.ClientID == "" || redirectBase == "" {
+			log.Printf("OIDC provider %q is missing its issuer, client ID or OIDC_REDIRECT_BASE_URL, skipping it", name)
+			continue
+		}
+		loaded[name] = provider
+	}
+
+	return loaded
+}
+
+// metadata returns the provider's discovery document, fetching it when missing or stale
+func (p *Provider) metadata(ctx context.Context) (*discoveryDocument, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil && time.Since(p.discoveredAt) < discoveryTTL {
+		return p.discovery, nil
+	}
+
+	var doc discoveryDocument
+	if err := getJSON(ctx, p.Issuer+"/.well-known/openid-configuration", &doc); err != nil {
+		return nil, fmt.Errorf("fetching discovery document: %w", err)
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("discovery document issuer %q does not match %q", doc.Issuer, p.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing required endpoints")
+	}
+
+	p.discovery = &doc
+	p.discoveredAt = time.Now()
+	p.keys = nil
+	return p.discovery, nil
+}
+
+// getJSON fetches a URL and decodes its JSON body
+func getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"civicsync-be/controllers"
+	"civicsync-be/middlewares"
+	"civicsync-be/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminRoutes sets up the administration routes
+func AdminRoutes(r *gin.Engine) {
+	admin := r.Group("/api/admin", middlewares.CSRFMiddleware(), middlewares.AuthMiddleware(), middlewares.RequireRole(models.RoleAdmin))
+	{
+		admin.PATCH("/users/:id/role", controllers.UpdateUserRole)
+		admin.PATCH("/users/:id/two-factor", controllers.UpdateTwoFactorRequirement)
+		admin.GET("/login-lockouts", controllers.GetLoginLockouts)
+	}
+}
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"civicsync-be/controllers"
+	"civicsync-be/middlewares"
+	"civicsync-be/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AssetRoutes sets up the photo upload and download routes
+func AssetRoutes(r *gin.Engine) {
+	assets := r.Group("/api/assets", middlewares.CSRFMiddleware())
+	read := middlewares.APIKeyMiddleware(models.ScopeIssuesRead)
+	write := middlewares.APIKeyMiddleware(models.ScopeIssuesWrite)
+	{
+		assets.POST("", write, middlewares.AuthMiddleware(), middlewares.RequireVerified(), middlewares.UploadRateLimiter(30), controllers.UploadAsset)
+		assets.GET("/:id", read, middlewares.OptionalAuthMiddleware(), controllers.GetAsset)
+		assets.GET("/:id/thumbnail", read, middlewares.OptionalAuthMiddleware(), controllers.GetAssetThumbnail)
+	}
+}
@@ -9,11 +9,45 @@ import (
 
 // AuthRoutes sets up the authentication routes
 func AuthRoutes(r *gin.Engine) {
-	auth := r.Group("/api/auth")
+	auth := r.Group("/api/auth", middlewares.CSRFMiddleware())
 	{
+		auth.GET("/csrf", controllers.GetCSRFToken)
 		auth.POST("/register", controllers.RegisterUser)
 		auth.POST("/login", controllers.LoginUser)
+		auth.POST("/magic-link", controllers.RequestMagicLink)
+		auth.POST("/magic-link/verify", controllers.ConsumeMagicLink)
+		auth.GET("/oidc/providers", controllers.GetOIDCProviders)
+		auth.GET("/oidc/:provider/login", controllers.StartOIDCLogin)
+		auth.GET("/oidc/:provider/callback", controllers.OIDCCallback)
+		auth.POST("/oidc/link", middlewares.AuthMiddleware(), middlewares.RequireVerified(), controllers.ConfirmOIDCLink)
+		auth.POST("/2fa/login", controllers.VerifyTwoFactorLogin)
+		auth.POST("/2fa/login/setup", controllers.SetupTwoFactorLogin)
+		auth.POST("/2fa/setup", middlewares.AuthMiddleware(), controllers.SetupTwoFactor)
+		auth.POST("/2fa/confirm", middlewares.AuthMiddleware(), controllers.ConfirmTwoFactor)
+		auth.POST("/2fa/disable", middlewares.AuthMiddleware(), controllers.DisableTwoFactor)
+		auth.POST("/2fa/recovery-codes", middlewares.AuthMiddleware(), controllers.RegenerateRecoveryCodes)
+		auth.POST("/verify", controllers.VerifyEmail)
+		auth.POST("/verify/resend", middlewares.AuthMiddleware(), controllers.ResendVerificationEmail)
+		auth.POST("/forgot-password", controllers.ForgotPassword)
+		auth.POST("/reset-password", controllers.ResetPassword)
+		auth.POST("/refresh", controllers.RefreshToken)
 		auth.POST("/logout", controllers.LogoutUser)
 		auth.GET("/me", middlewares.AuthMiddleware(), controllers.GetMe)
+		auth.PATCH("/me", middlewares.AuthMiddleware(), controllers.UpdateProfile)
+		auth.DELETE("/me", middlewares.AuthMiddleware(), controllers.DeleteAccount)
+		auth.POST("/me/cancel-deletion", middlewares.AuthMiddleware(), controllers.CancelAccountDeletion)
+		auth.POST("/me/password", middlewares.AuthMiddleware(), controllers.ChangePassword)
+		auth.POST("/me/reauthenticate", middlewares.AuthMiddleware(), controllers.RequestReauthentication)
+		auth.POST("/me/email", middlewares.AuthMiddleware(), controllers.RequestEmailChange)
+		auth.POST("/me/email/confirm", controllers.ConfirmEmailChange)
+		auth.POST("/me/export", middlewares.AuthMiddleware(), controllers.RequestDataExport)
+		auth.GET("/me/exports/:id", middlewares.AuthMiddleware(), controllers.GetDataExport)
+		auth.GET("/me/exports/:id/download", middlewares.AuthMiddleware(), controllers.DownloadDataExport)
+		auth.GET("/sessions", middlewares.AuthMiddleware(), controllers.GetSessions)
+		auth.DELETE("/sessions/:id", middlewares.AuthMiddleware(), controllers.RevokeSession)
+		auth.POST("/logout-all", middlewares.AuthMiddleware(), controllers.LogoutAllSessions)
+		auth.POST("/api-keys", middlewares.AuthMiddleware(), controllers.CreateAPIKey)
+		auth.GET("/api-keys", middlewares.AuthMiddleware(), controllers.GetAPIKeys)
+		auth.DELETE("/api-keys/:id", middlewares.AuthMiddleware(), controllers.RevokeAPIKey)
 	}
 }
@@ -3,22 +3,33 @@ package routes
 import (
 	"civicsync-be/controllers"
 	"civicsync-be/middlewares"
+	"civicsync-be/models"
 
 	"github.com/gin-gonic/gin"
 )
 
 // IssueRoutes sets up the issue routes
 func IssueRoutes(r *gin.Engine) {
-	issue := r.Group("/api/issue")
+	issue := r.Group("/api/issue", middlewares.CSRFMiddleware())
+	read := middlewares.APIKeyMiddleware(models.ScopeIssuesRead)
+	write := middlewares.APIKeyMiddleware(models.ScopeIssuesWrite)
 	{
-		issue.POST("/create", middlewares.AuthMiddleware(), middlewares.IssueRateLimiter(2), controllers.CreateIssue)
-		issue.GET("/:id", controllers.GetIssue)
-		issue.GET("/issues", controllers.GetAllIssues)
-		issue.GET("/user", middlewares.AuthMiddleware(), controllers.GetIssuesByUser)
-		issue.PATCH("/update/:id", middlewares.AuthMiddleware(), controllers.UpdateIssue)
-		issue.DELETE("/delete/:id", middlewares.AuthMiddleware(), controllers.DeleteIssue)
-		issue.POST("/vote/:id", middlewares.AuthMiddleware(), controllers.HandleVoteOnIssue)
-		issue.GET("/analytics", controllers.GetIssueAnalytics)
-		issue.GET("/recent-issues", controllers.RecentIssues)
+		issue.POST("/create", write, middlewares.AuthMiddleware(), middlewares.RequireVerified(), middlewares.IssueRateLimiter(2), controllers.CreateIssue)
+		issue.GET("/:id", read, middlewares.OptionalAuthMiddleware(), controllers.GetIssue)
+		issue.GET("/:id/timeline", read, middlewares.OptionalAuthMiddleware(), controllers.GetIssueTimeline)
+		issue.GET("/:id/comments", read, middlewares.OptionalAuthMiddleware(), controllers.GetComments)
+		issue.POST("/:id/comments", write, middlewares.AuthMiddleware(), middlewares.RequireVerified(), middlewares.CommentRateLimiter(20), controllers.CreateComment)
+		issue.PATCH("/:id/comments/:commentId", write, middlewares.AuthMiddleware(), controllers.UpdateComment)
+		issue.DELETE("/:id/comments/:commentId", write, middlewares.AuthMiddleware(), controllers.DeleteComment)
+		issue.POST("/:id/attachments", write, middlewares.AuthMiddleware(), middlewares.RequireVerified(), controllers.AddIssueAttachment)
+		issue.PUT("/:id/attachments/order", write, middlewares.AuthMiddleware(), controllers.ReorderIssueAttachments)
+		issue.DELETE("/:id/attachments/:assetId", write, middlewares.AuthMiddleware(), controllers.RemoveIssueAttachment)
+		issue.GET("/issues", read, middlewares.OptionalAuthMiddleware(), controllers.GetAllIssues)
+		issue.GET("/user", read, middlewares.AuthMiddleware(), controllers.GetIssuesByUser)
+		issue.PATCH("/update/:id", write, middlewares.AuthMiddleware(), controllers.UpdateIssue)
+		issue.DELETE("/delete/:id", write, middlewares.AuthMiddleware(), controllers.DeleteIssue)
+		issue.POST("/vote/:id", write, middlewares.AuthMiddleware(), middlewares.RequireVerified(), controllers.HandleVoteOnIssue)
+		issue.GET("/analytics", middlewares.APIKeyMiddleware(models.ScopeAnalyticsRead), controllers.GetIssueAnalytics)
+		issue.GET("/recent-issues", read, controllers.RecentIssues)
 	}
 }
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"civicsync-be/controllers"
+	"civicsync-be/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UserRoutes sets up the public user profile routes
+func UserRoutes(r *gin.Engine) {
+	users := r.Group("/api/users", middlewares.CSRFMiddleware())
+	{
+		users.GET("/:id", middlewares.OptionalAuthMiddleware(), controllers.GetPublicProfile)
+	}
+}
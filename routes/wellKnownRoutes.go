@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"civicsync-be/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WellKnownRoutes sets up the /.well-known discovery routes
+func WellKnownRoutes(r *gin.Engine) {
+	wellKnown := r.Group("/.well-known")
+	{
+		wellKnown.GET("/jwks.json", controllers.GetJWKS)
+	}
+}
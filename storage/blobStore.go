@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+// ErrNotFound is returned when no blob is stored under a key
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore keeps uploaded files such as issue photos
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+var (
+	defaultStore BlobStore
+	once         sync.Once
+)
+
+// Default returns the store selected by STORAGE_DRIVER ("local" or "s3", defaulting to "local")
+func Default() BlobStore {
+	once.Do(func() {
+		switch os.Getenv("STORAGE_DRIVER") {
+		case "s3":
+			defaultStore = NewS3Store()
+		case "", "local":
+			store, err := NewLocalStore(os.Getenv("STORAGE_DIR"))
+			if err != nil {
+				log.Fatal(err)
+			}
+			defaultStore = store
+		default:
+			log.Fatalf("Unknown STORAGE_DRIVER %q", os.Getenv("STORAGE_DRIVER"))
+		}
+	})
+
+	return defaultStore
+}
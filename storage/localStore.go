@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStore keeps blobs as files below a directory on the local filesystem
+type LocalStore struct {
+	Dir string
+}
+
+// NewLocalStore returns a LocalStore. Outside production an empty dir stores blobs in the system temp
+// directory; in production a dir is required, since the temp directory does not survive a redeploy.
+func NewLocalStore(dir string) (*LocalStore, error) {
+	if dir == "" {
+		if os.Getenv("GO_ENV") == "production" {
+			return nil, errors.New("STORAGE_DIR must be set to store uploads locally in production")
+		}
+		dir = filepath.Join(os.TempDir(), "civicsync-uploads")
+	}
+	return &LocalStore{Dir: dir}, nil
+}
+
+// Put writes the blob through a temporary file so readers never see a partial upload
+func (s *LocalStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// Get opens the blob for reading
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// Delete removes the blob; deleting a missing blob is not an error
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// path maps a key to a file below Dir, refusing keys that would escape it
+func (s *LocalStore) path(key string) (string, error) {
+	if !filepath.IsLocal(key) || strings.Contains(key, `\`) {
+		return "", errors.New("invalid blob key " + key)
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(key)), nil
+}
@@ -0,0 +1,31 @@
+package authUtils
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+const apiKeyPrefix = "cs_"
+
+// GenerateAPIKey returns a new API key, the short prefix shown in listings and the hash to store
+func GenerateAPIKey() (key string, prefix string, keyHash string, err error) {
+	idBytes := make([]byte, 4)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", "", "", err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+
+	prefix = apiKeyPrefix + hex.EncodeToString(idBytes)
+	key = prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+
+	return key, prefix, HashAPIKey(key), nil
+}
+
+// HashAPIKey returns the hash under which an API key is stored
+func HashAPIKey(key string) string {
+	return hashToken(key)
+}
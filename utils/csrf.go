@@ -0,0 +1,43 @@
+package authUtils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+)
+
+// Names of the CSRF cookie and of the header the SPA echoes it in
+const (
+	CSRFCookieName = "csrf_token"
+	CSRFHeaderName = "X-CSRF-Token"
+)
+
+// GenerateCSRFToken returns a random token for the double-submit cookie
+func GenerateCSRFToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// ValidCSRFToken reports whether the header token matches the CSRF cookie
+func ValidCSRFToken(r *http.Request) bool {
+	cookie, err := r.Cookie(CSRFCookieName)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	header := r.Header.Get(CSRFHeaderName)
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) == 1
+}
+
+// HasAuthCookies reports whether the browser sent an auth or refresh cookie, i.e. whether the request could be forged
+func HasAuthCookies(r *http.Request) bool {
+	for _, name := range []string{"auth_token", "refresh_token"} {
+		if cookie, err := r.Cookie(name); err == nil && cookie.Value != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package authUtils
+
+import (
+	"time"
+
+	"civicsync-be/config"
+	"civicsync-be/models"
+)
+
+const (
+	magicLinkRatePrefix     = "magic_link_rate:"
+	passwordResetRatePrefix = "password_reset_rate:"
+	reauthRatePrefix        = "reauth_rate:"
+)
+
+// Each address may be sent MagicLinkRequestLimit sign-in links per MagicLinkRateWindow
+const (
+	MagicLinkRequestLimit = 3
+	MagicLinkRateWindow   = 15 * time.Minute
+)
+
+// Each address may be sent PasswordResetRequestLimit reset links per PasswordResetRateWindow
+const (
+	PasswordResetRequestLimit = 3
+	PasswordResetRateWindow   = 15 * time.Minute
+)
+
+// Each address may be sent ReauthRequestLimit confirmation links per ReauthRateWindow
+const (
+	ReauthRequestLimit = 3
+	ReauthRateWindow   = 15 * time.Minute
+)
+
+// AllowMagicLinkRequest counts a magic link request for the address and returns how long to wait once the limit is used up
+func AllowMagicLinkRequest(email string) (time.Duration, error) {
+	return allowEmailRequest(magicLinkRatePrefix, email, MagicLinkRequestLimit, MagicLinkRateWindow)
+}
+
+// AllowPasswordResetRequest counts a password reset request for the address and returns how long to wait once the limit is used up
+func AllowPasswordResetRequest(email string) (time.Duration, error) {
+	return allowEmailRequest(passwordResetRatePrefix, email, PasswordResetRequestLimit, PasswordResetRateWindow)
+}
+
+// AllowReauthRequest counts a request for a confirmation link and returns how long to wait once the limit is used up
+func AllowReauthRequest(email string) (time.Duration, error) {
+	return allowEmailRequest(reauthRatePrefix, email, ReauthRequestLimit, ReauthRateWindow)
+}
+
+// allowEmailRequest is a fixed-window counter per address, so nobody can flood an inbox with our emails
+func allowEmailRequest(prefix, email string, limit int64, window time.Duration) (time.Duration, error) {
+	ctx := config.Ctx
+	key := prefix + models.NormalizeEmail(email)
+
+	count, err := config.RedisClient.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if count == 1 {
+		if err := config.RedisClient.Expire(ctx, key, window).Err(); err != nil {
+			return 0, err
+		}
+	}
+
+	if count <= limit {
+		return 0, nil
+	}
+
+	retryAfter, err := config.RedisClient.PTTL(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if retryAfter <= 0 {
+		retryAfter = window
+	}
+	return retryAfter, nil
+}
@@ -0,0 +1,212 @@
+package authUtils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrSigningKeyMissing is returned when no usable JWT signing key is configured
+var ErrSigningKeyMissing = errors.New("JWT signing key is not configured")
+
+// jwtKey is one key of the keyring; Private is nil for verification-only keys
+type jwtKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+// jwtKeyring holds the active signing key and every key still accepted for verification
+type jwtKeyring struct {
+	active *jwtKey
+	keys   map[string]*jwtKey
+}
+
+var (
+	keyring     *jwtKeyring
+	keyringErr  error
+	keyringOnce sync.Once
+)
+
+// LoadSigningKeys loads the JWT keyring. Keys are PEM files named <kid>.pem in JWT_KEYS_DIR: Ed25519 or RSA
+// private keys (PKCS#8) can sign and verify, public keys (PKIX) only verify. JWT_ACTIVE_KID selects the signing key.
+//
+// To rotate, add the new private key, point JWT_ACTIVE_KID at it and restart. Keep the old file (its public
+// half is enough) until every token it signed has expired, then remove it.
+//
+// Outside production a missing JWT_KEYS_DIR falls back to an ephemeral Ed25519 key, so tokens do not survive restarts.
+func LoadSigningKeys() error {
+	keyringOnce.Do(func() {
+		keyring, keyringErr = loadKeyring()
+	})
+	return keyringErr
+}
+
+func loadKeyring() (*jwtKeyring, error) {
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		if os.Getenv("GO_ENV") == "production" {
+			return nil, ErrSigningKeyMissing
+		}
+		log.Println("JWT_KEYS_DIR not set, using an ephemeral signing key")
+		return ephemeralKeyring()
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	ring := &jwtKeyring{keys: make(map[string]*jwtKey)}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := parseJWTKey(kid, data)
+		if err != nil {
+			return nil, fmt.Errorf("loading JWT key %s: %w", path, err)
+		}
+		ring.keys[kid] = key
+	}
+
+	activeKID := os.Getenv("JWT_ACTIVE_KID")
+	active, ok := ring.keys[activeKID]
+	if !ok || active.Private == nil {
+		return nil, fmt.Errorf("%w: JWT_ACTIVE_KID %q must name a private key in %s", ErrSigningKeyMissing, activeKID, dir)
+	}
+	ring.active = active
+
+	return ring, nil
+}
+
+func ephemeralKeyring() (*jwtKeyring, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &jwtKey{ID: "ephemeral", Method: jwt.SigningMethodEdDSA, Private: private, Public: public}
+	return &jwtKeyring{active: key, keys: map[string]*jwtKey{key.ID: key}}, nil
+}
+
+// parseJWTKey reads a PKCS#8 private key or a PKIX public key
+func parseJWTKey(kid string, data []byte) (*jwtKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &jwtKey{ID: kid}
+	switch k := parsed.(type) {
+	case ed25519.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodEdDSA, k
+	case *rsa.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodRS256, k, k.Public()
+	case *rsa.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodRS256, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	return key, nil
+}
+
+// signJWT signs the claims with the active key and sets its kid header
+func signJWT(claims jwt.Claims) (string, error) {
+	if err := LoadSigningKeys(); err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(keyring.active.Method, claims)
+	token.Header["kid"] = keyring.active.ID
+	return token.SignedString(keyring.active.Private)
+}
+
+// parseJWT verifies a token against the key named by its kid header and fills claims
+func parseJWT(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	if err := LoadSigningKeys(); err != nil {
+		return nil, err
+	}
+
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := keyring.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.Public, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg(), jwt.SigningMethodRS256.Alg()}))
+}
+
+// JWKS returns the public verification keys as a JSON Web Key Set
+func JWKS() (map[string]interface{}, error) {
+	if err := LoadSigningKeys(); err != nil {
+		return nil, err
+	}
+
+	kids := make([]string, 0, len(keyring.keys))
+	for kid := range keyring.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	keys := make([]map[string]interface{}, 0, len(kids))
+	for _, kid := range kids {
+		key := keyring.keys[kid]
+		jwk := map[string]interface{}{
+			"kid": key.ID,
+			"use": "sig",
+			"alg": key.Method.Alg(),
+		}
+		switch pub := key.Public.(type) {
+		case ed25519.PublicKey:
+			jwk["kty"] = "OKP"
+			jwk["crv"] = "Ed25519"
+			jwk["x"] = base64.RawURLEncoding.EncodeToString(pub)
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		}
+		keys = append(keys, jwk)
+	}
+
+	return map[string]interface{}{"keys": keys}, nil
+}
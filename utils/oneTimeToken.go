@@ -0,0 +1,117 @@
+package authUtils
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"civicsync-be/config"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Purposes of opaque one-time tokens
+const (
+	PurposeVerifyEmail    = "verify_email"
+	PurposeChangeEmail    = "change_email"
+	PurposePasswordReset  = "password_reset"
+	PurposeMagicLink      = "magic_link"
+	PurposeLinkIdentity   = "link_identity"
+	PurposeReauthenticate = "reauthenticate"
+)
+
+// oneTimeTokenPurposes lists every purpose so all of a user's tokens can be revoked
+var oneTimeTokenPurposes = []string{PurposeVerifyEmail, PurposeChangeEmail, PurposePasswordReset, PurposeMagicLink, PurposeLinkIdentity, PurposeReauthenticate}
+
+const (
+	oneTimeTokenPrefix     = "one_time_token:"
+	oneTimeTokenUserPrefix = "one_time_token_user:"
+)
+
+// ErrOneTimeTokenInvalid is returned for unknown, expired or already used one-time tokens
+var ErrOneTimeTokenInvalid = errors.New("one-time token is invalid or expired")
+
+// OneTimeToken is what a one-time token authorizes: an action for a user,
+// optionally bound to an email address such as the one being verified, or to the provider account being linked
+type OneTimeToken struct {
+	UserID   string `json:"userId"`
+	Email    string `json:"email,omitempty"`
+	Provider string `json:"provider,omitempty"`
+	Subject  string `json:"subject,omitempty"`
+}
+
+// IssueOneTimeToken creates a random single-use token for the purpose.
+// Only its hash is stored, and issuing a new token invalidates the user's previous one for the same purpose.
+func IssueOneTimeToken(purpose string, subject OneTimeToken, ttl time.Duration) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	tokenHash := hashToken(token)
+
+	value, err := json.Marshal(subject)
+	if err != nil {
+		return "", err
+	}
+
+	ctx := config.Ctx
+	userKey := oneTimeTokenUserPrefix + purpose + ":" + subject.UserID
+
+	previousHash, err := config.RedisClient.Get(ctx, userKey).Result()
+	if err != nil && err != redis.Nil {
+		return "", err
+	}
+
+	pipe := config.RedisClient.TxPipeline()
+	if previousHash != "" {
+		pipe.Del(ctx, oneTimeTokenPrefix+purpose+":"+previousHash)
+	}
+	pipe.Set(ctx, oneTimeTokenPrefix+purpose+":"+tokenHash, value, ttl)
+	pipe.Set(ctx, userKey, tokenHash, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// ConsumeOneTimeToken atomically redeems a token and returns what it was issued for
+func ConsumeOneTimeToken(purpose, token string) (*OneTimeToken, error) {
+	value, err := config.RedisClient.GetDel(config.Ctx, oneTimeTokenPrefix+purpose+":"+hashToken(token)).Result()
+	if err == redis.Nil {
+		return nil, ErrOneTimeTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	subject := &OneTimeToken{}
+	if err := json.Unmarshal([]byte(value), subject); err != nil || subject.UserID == "" {
+		return nil, ErrOneTimeTokenInvalid
+	}
+
+	config.RedisClient.Del(config.Ctx, oneTimeTokenUserPrefix+purpose+":"+subject.UserID)
+	return subject, nil
+}
+
+// RevokeOneTimeTokens invalidates the user's outstanding tokens of every purpose
+func RevokeOneTimeTokens(userID string) error {
+	ctx := config.Ctx
+	for _, purpose := range oneTimeTokenPurposes {
+		userKey := oneTimeTokenUserPrefix + purpose + ":" + userID
+		tokenHash, err := config.RedisClient.Get(ctx, userKey).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := config.RedisClient.Del(ctx, oneTimeTokenPrefix+purpose+":"+tokenHash, userKey).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
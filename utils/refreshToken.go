@@ -0,0 +1,141 @@
+package authUtils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"civicsync-be/config"
+)
+
+// RefreshTokenTTL is the lifetime of a refresh token and of an idle session
+const RefreshTokenTTL = 7 * 24 * time.Hour
+
+const (
+	refreshTokenPrefix = "refresh_token:"
+	revokedJTIPrefix   = "revoked_jti:"
+)
+
+// ErrRefreshTokenInvalid is returned for unknown, expired or revoked refresh tokens
+var ErrRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+
+// ErrRefreshTokenReused is returned when an already rotated refresh token is presented again
+var ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+
+// IssueRefreshToken returns the first refresh token of a session.
+// All tokens rotated from it form one family that lives and dies with the session.
+func IssueRefreshToken(userID, sessionID string) (string, error) {
+	return storeRefreshToken(userID, sessionID)
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one in the same session.
+// Presenting a token that was already rotated revokes the whole session.
+func RotateRefreshToken(refreshToken string) (userID string, sessionID string, newRefreshToken string, err error) {
+	ctx := config.Ctx
+	tokenKey := refreshTokenPrefix + hashToken(refreshToken)
+
+	data, err := config.RedisClient.HGetAll(ctx, tokenKey).Result()
+	if err != nil {
+		return "", "", "", err
+	}
+	userID, sessionID = data["user_id"], data["session_id"]
+	if userID == "" || sessionID == "" {
+		return "", "", "", ErrRefreshTokenInvalid
+	}
+
+	active, err := TouchSession(sessionID)
+	if err != nil {
+		return "", "", "", err
+	}
+	if !active {
+		return "", "", "", ErrRefreshTokenInvalid
+	}
+
+	// HINCRBY is atomic, so only one concurrent caller can claim the token
+	used, err := config.RedisClient.HIncrBy(ctx, tokenKey, "used", 1).Result()
+	if err != nil {
+		return "", "", "", err
+	}
+	if used > 1 {
+		log.Printf("Refresh token reuse detected for user %s, revoking session %s", userID, sessionID)
+		if err := RevokeSession(userID, sessionID); err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return "", "", "", err
+		}
+		return "", "", "", ErrRefreshTokenReused
+	}
+
+	if err := ExtendSession(sessionID); err != nil {
+		return "", "", "", err
+	}
+
+	newRefreshToken, err = storeRefreshToken(userID, sessionID)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	return userID, sessionID, newRefreshToken, nil
+}
+
+// RevokeRefreshToken revokes the session the given refresh token belongs to
+func RevokeRefreshToken(refreshToken string) error {
+	data, err := config.RedisClient.HGetAll(config.Ctx, refreshTokenPrefix+hashToken(refreshToken)).Result()
+	if err != nil {
+		return err
+	}
+	if data["user_id"] == "" || data["session_id"] == "" {
+		return nil
+	}
+
+	if err := RevokeSession(data["user_id"], data["session_id"]); err != nil && !errors.Is(err, ErrSessionNotFound) {
+		return err
+	}
+	return nil
+}
+
+// RevokeAccessToken adds the token ID to the denylist until the token would have expired anyway
+func RevokeAccessToken(jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return config.RedisClient.Set(config.Ctx, revokedJTIPrefix+jti, 1, ttl).Err()
+}
+
+// IsAccessTokenRevoked reports whether the token ID is on the denylist
+func IsAccessTokenRevoked(jti string) (bool, error) {
+	count, err := config.RedisClient.Exists(config.Ctx, revokedJTIPrefix+jti).Result()
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// storeRefreshToken creates a new random refresh token in the given session
+func storeRefreshToken(userID, sessionID string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	refreshToken := base64.RawURLEncoding.EncodeToString(buf)
+
+	// Only the hash is stored so a Redis dump cannot be replayed
+	tokenKey := refreshTokenPrefix + hashToken(refreshToken)
+	pipe := config.RedisClient.TxPipeline()
+	pipe.HSet(config.Ctx, tokenKey, "user_id", userID, "session_id", sessionID, "used", 0)
+	pipe.Expire(config.Ctx, tokenKey, RefreshTokenTTL)
+	if _, err := pipe.Exec(config.Ctx); err != nil {
+		return "", err
+	}
+
+	return refreshToken, nil
+}
+
+// hashToken returns the hex encoded SHA-256 of a token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,203 @@
+package authUtils
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"civicsync-be/config"
+	"civicsync-be/models"
+
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	sessionPrefix      = "session:"
+	userSessionsPrefix = "user_sessions:"
+)
+
+// Defaults for the session lifetime limits, overridable with SESSION_IDLE_TIMEOUT and SESSION_MAX_LIFETIME
+const (
+	defaultSessionIdleTimeout = RefreshTokenTTL
+	defaultSessionMaxLifetime = 30 * 24 * time.Hour
+)
+
+// ErrSessionNotFound is returned when a session does not exist or belongs to another user
+var ErrSessionNotFound = errors.New("session not found")
+
+// touchSessionScript updates last_seen only if the session still exists, so a revoked session is never recreated.
+// Sessions past the absolute lifetime (ARGV[2]) or idle longer than the idle timeout (ARGV[3]) are deleted instead.
+var touchSessionScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+local now = tonumber(ARGV[1])
+local created = tonumber(redis.call("HGET", KEYS[1], "created_at") or "0")
+local lastSeen = tonumber(redis.call("HGET", KEYS[1], "last_seen") or "0")
+if now - created > tonumber(ARGV[2]) or now - lastSeen > tonumber(ARGV[3]) then
+	redis.call("DEL", KEYS[1])
+	return 0
+end
+redis.call("HSET", KEYS[1], "last_seen", ARGV[1])
+redis.call("EXPIRE", KEYS[1], ARGV[3])
+return 1
+`)
+
+// SessionIdleTimeout is how long a session survives without any request
+func SessionIdleTimeout() time.Duration {
+	return sessionDurationFromEnv("SESSION_IDLE_TIMEOUT", defaultSessionIdleTimeout)
+}
+
+// SessionMaxLifetime is how long a session lives at most, however active it is
+func SessionMaxLifetime() time.Duration {
+	return sessionDurationFromEnv("SESSION_MAX_LIFETIME", defaultSessionMaxLifetime)
+}
+
+// sessionDurationFromEnv parses a duration such as "12h" from the environment, falling back to def
+func sessionDurationFromEnv(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid %s %q, using %s", name, value, def)
+		return def
+	}
+	return d
+}
+
+// CreateSession registers a new session for the user
+func CreateSession(userID, device, ip, userAgent string) (*models.Session, error) {
+	now := time.Now()
+	session := &models.Session{
+		ID:        primitive.NewObjectID().Hex(),
+		UserID:    userID,
+		Device:    device,
+		IP:        ip,
+		UserAgent: userAgent,
+		CreatedAt: now,
+		LastSeen:  now,
+	}
+
+	ctx := config.Ctx
+	sessionKey := sessionPrefix + session.ID
+	pipe := config.RedisClient.TxPipeline()
+	pipe.HSet(ctx, sessionKey,
+		"user_id", userID,
+		"device", device,
+		"ip", ip,
+		"user_agent", userAgent,
+		"created_at", now.Unix(),
+		"last_seen", now.Unix(),
+	)
+	pipe.Expire(ctx, sessionKey, SessionIdleTimeout())
+	pipe.SAdd(ctx, userSessionsPrefix+userID, session.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// TouchSession records activity on a session, restarting its idle timeout, and reports whether it is still active
+func TouchSession(sessionID string) (bool, error) {
+	active, err := touchSessionScript.Run(config.Ctx, config.RedisClient, []string{sessionPrefix + sessionID},
+		time.Now().Unix(), int64(SessionMaxLifetime().Seconds()), int64(SessionIdleTimeout().Seconds()),
+	).Int()
+	if err != nil {
+		return false, err
+	}
+	return active == 1, nil
+}
+
+// ExtendSession pushes back the idle expiry of a session
+func ExtendSession(sessionID string) error {
+	return config.RedisClient.Expire(config.Ctx, sessionPrefix+sessionID, SessionIdleTimeout()).Err()
+}
+
+// ListSessions returns the active sessions of a user, pruning expired entries from the registry
+func ListSessions(userID string) ([]models.Session, error) {
+	ctx := config.Ctx
+	registryKey := userSessionsPrefix + userID
+
+	sessionIDs, err := config.RedisClient.SMembers(ctx, registryKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]models.Session, 0, len(sessionIDs))
+	for _, sessionID := range sessionIDs {
+		data, err := config.RedisClient.HGetAll(ctx, sessionPrefix+sessionID).Result()
+		if err != nil {
+			return nil, err
+		}
+		if data["user_id"] != userID {
+			config.RedisClient.SRem(ctx, registryKey, sessionID)
+			continue
+		}
+
+		createdAt, _ := strconv.ParseInt(data["created_at"], 10, 64)
+		lastSeen, _ := strconv.ParseInt(data["last_seen"], 10, 64)
+		sessions = append(sessions, models.Session{
+			ID:        sessionID,
+			UserID:    userID,
+			Device:    data["device"],
+			IP:        data["ip"],
+			UserAgent: data["user_agent"],
+			CreatedAt: time.Unix(createdAt, 0),
+			LastSeen:  time.Unix(lastSeen, 0),
+		})
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession deletes one of the user's sessions, invalidating its refresh and access tokens
+func RevokeSession(userID, sessionID string) error {
+	ctx := config.Ctx
+
+	owner, err := config.RedisClient.HGet(ctx, sessionPrefix+sessionID, "user_id").Result()
+	if err == redis.Nil || (err == nil && owner != userID) {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	pipe := config.RedisClient.TxPipeline()
+	pipe.Del(ctx, sessionPrefix+sessionID)
+	pipe.SRem(ctx, userSessionsPrefix+userID, sessionID)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// RevokeAllSessions deletes every session of the user
+func RevokeAllSessions(userID string) error {
+	return RevokeOtherSessions(userID, "")
+}
+
+// RevokeOtherSessions deletes every session of the user except keepSessionID
+func RevokeOtherSessions(userID, keepSessionID string) error {
+	ctx := config.Ctx
+	registryKey := userSessionsPrefix + userID
+
+	sessionIDs, err := config.RedisClient.SMembers(ctx, registryKey).Result()
+	if err != nil {
+		return err
+	}
+
+	pipe := config.RedisClient.TxPipeline()
+	for _, sessionID := range sessionIDs {
+		if sessionID == keepSessionID {
+			continue
+		}
+		pipe.Del(ctx, sessionPrefix+sessionID)
+		pipe.SRem(ctx, registryKey, sessionID)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
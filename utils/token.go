@@ -1,31 +1,119 @@
 package authUtils
 
 import (
-	"fmt"
+	"errors"
+	"net/http"
 	"os"
+	"strings"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
+	"civicsync-be/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// GenerateAndSetToken generates a JWT token for a given user ID
-func GenerateAndSetToken(userID string) (string, error) {
-	secretStr := os.Getenv("JWT_SECRET")
-	if secretStr == "" {
-		return "", fmt.Errorf("JWT_SECRET environment variable is not set")
-	}
+// AccessTokenTTL is the lifetime of an access token
+const AccessTokenTTL = 15 * time.Minute
+
+// AccessTokenRenewalWindow is how close to expiry an access token must be for AuthMiddleware to replace it
+const AccessTokenRenewalWindow = 5 * time.Minute
+
+// RenewedAccessTokenHeader carries the replacement token to Bearer clients
+const RenewedAccessTokenHeader = "X-Renewed-Access-Token"
 
-	jwtSecret := []byte(secretStr)
+// ErrInvalidClaims is returned when a token is signed correctly but carries unusable claims
+var ErrInvalidClaims = errors.New("invalid token claims")
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 72).Unix(), // Token expires in 72 hours
+// AccessClaims are the claims carried by an access token
+type AccessClaims struct {
+	UserID    string `json:"user_id"`
+	SessionID string `json:"sid"`
+	Role      string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// GenerateAndSetToken generates a short-lived JWT access token for a given user, session and role
+func GenerateAndSetToken(userID, sessionID string, role models.Role) (string, error) {
+	now := time.Now()
+	return signJWT(AccessClaims{
+		UserID:    userID,
+		SessionID: sessionID,
+		Role:      string(role),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        primitive.NewObjectID().Hex(),
+			Subject:   userID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
+		},
 	})
+}
 
-	tokenString, err := token.SignedString(jwtSecret)
+// ParseAccessToken verifies the token signature and expiry and returns its claims
+func ParseAccessToken(tokenString string) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	token, err := parseJWT(tokenString, claims)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("token is not valid")
+	}
+
+	if claims.UserID == "" || claims.SessionID == "" || claims.ID == "" || claims.ExpiresAt == nil {
+		return nil, ErrInvalidClaims
+	}
+
+	return claims, nil
+}
+
+// Ways an access token can be presented
+const (
+	AuthMethodCookie = "cookie"
+	AuthMethodBearer = "bearer"
+	AuthMethodAPIKey = "api_key"
+)
+
+// AccessTokenFromRequest returns the access token from an "Authorization: Bearer" header,
+// falling back to the auth_token cookie, together with the method it was found by
+func AccessTokenFromRequest(r *http.Request) (string, string) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, found := strings.Cut(header, " ")
+		if found && strings.EqualFold(scheme, "Bearer") && strings.TrimSpace(token) != "" {
+			return strings.TrimSpace(token), AuthMethodBearer
+		}
 	}
 
-	return tokenString, nil
+	if cookie, err := r.Cookie("auth_token"); err == nil && cookie.Value != "" {
+		return cookie.Value, AuthMethodCookie
+	}
+
+	return "", ""
+}
+
+// SetAccessTokenCookie writes the auth_token cookie holding an access token
+func SetAccessTokenCookie(w http.ResponseWriter, accessToken string) {
+	environment := os.Getenv("GO_ENV")
+	domain := os.Getenv("DOMAIN")
+
+	// For production, don't set domain to allow cross-origin cookies
+	if environment == "production" {
+		domain = ""
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "auth_token",
+		Value:    accessToken,
+		MaxAge:   int(AccessTokenTTL.Seconds()),
+		Path:     "/",
+		Domain:   domain,
+		Secure:   environment == "production", // false for HTTP (dev), true for HTTPS (prod)
+		HttpOnly: true,                        // still protect from JS access
+		SameSite: http.SameSiteNoneMode,       // Required for cross-origin cookies in production
+	})
+}
+
+// IsTokenExpired reports whether err reports an expired token; the signature has been verified by then
+func IsTokenExpired(err error) bool {
+	return errors.Is(err, jwt.ErrTokenExpired)
 }
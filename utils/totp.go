@@ -0,0 +1,122 @@
+package authUtils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"civicsync-be/config"
+)
+
+// TOTP parameters (RFC 6238 defaults understood by every authenticator app)
+const (
+	totpIssuer = "CivicSync"
+	totpDigits = 6
+	totpPeriod = 30 * time.Second
+	// Codes from one step before or after are accepted to allow for clock drift
+	totpSkew = 1
+)
+
+const usedTOTPPrefix = "used_totp:"
+
+// GenerateTOTPSecret returns a random base32 encoded secret for an authenticator app
+func GenerateTOTPSecret() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf), nil
+}
+
+// TOTPURI returns the otpauth:// URI that authenticator apps import, usually through a QR code
+func TOTPURI(secret, accountName string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", totpIssuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", strconv.Itoa(totpDigits))
+	params.Set("period", strconv.Itoa(int(totpPeriod.Seconds())))
+
+	label := url.PathEscape(totpIssuer + ":" + accountName)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// ValidateTOTP checks a code against the secret and rejects codes already used by the user
+func ValidateTOTP(userID, secret, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return false, nil
+	}
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return false, err
+	}
+
+	current := time.Now().Unix() / int64(totpPeriod.Seconds())
+	for offset := -totpSkew; offset <= totpSkew; offset++ {
+		step := current + int64(offset)
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) != 1 {
+			continue
+		}
+
+		// A code stays valid for several steps, so remember it to stop replays
+		ttl := time.Duration(2*totpSkew+1) * totpPeriod
+		firstUse, err := config.RedisClient.SetNX(config.Ctx, usedTOTPPrefix+userID+":"+strconv.FormatInt(step, 10), 1, ttl).Result()
+		if err != nil {
+			return false, err
+		}
+		return firstUse, nil
+	}
+
+	return false, nil
+}
+
+// totpCode computes the HOTP value (RFC 4226) for a time step
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// GenerateRecoveryCodes returns n single-use recovery codes and the hashes to store for them
+func GenerateRecoveryCodes(n int) (codes []string, hashes []string, err error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	for i := 0; i < n; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(encoding.EncodeToString(buf))
+		code := raw[:4] + "-" + raw[4:]
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode returns the stored form of a recovery code, ignoring case and the separator
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	return hashToken(normalized)
+}
@@ -0,0 +1,80 @@
+package authUtils
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"civicsync-be/config"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TwoFactorChallengeTTL is how long a user has to enter their code after the password step
+const TwoFactorChallengeTTL = 5 * time.Minute
+
+// A challenge is discarded after this many wrong codes and the user has to log in again
+const maxTwoFactorAttempts = 5
+
+const (
+	twoFactorChallengePrefix = "two_factor_challenge:"
+	twoFactorAttemptsPrefix  = "two_factor_attempts:"
+)
+
+// ErrTwoFactorChallengeInvalid is returned for unknown, expired or exhausted login challenges
+var ErrTwoFactorChallengeInvalid = errors.New("two-factor challenge is invalid or expired")
+
+// IssueTwoFactorChallenge records that the user passed the first login step and returns the challenge for the second
+func IssueTwoFactorChallenge(userID string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	challenge := base64.RawURLEncoding.EncodeToString(buf)
+
+	if err := config.RedisClient.Set(config.Ctx, twoFactorChallengePrefix+hashToken(challenge), userID, TwoFactorChallengeTTL).Err(); err != nil {
+		return "", err
+	}
+	return challenge, nil
+}
+
+// TwoFactorChallengeUser returns the user a pending challenge belongs to
+func TwoFactorChallengeUser(challenge string) (string, error) {
+	userID, err := config.RedisClient.Get(config.Ctx, twoFactorChallengePrefix+hashToken(challenge)).Result()
+	if err == redis.Nil {
+		return "", ErrTwoFactorChallengeInvalid
+	}
+	return userID, err
+}
+
+// RecordTwoFactorFailure counts a wrong code and discards the challenge once too many were entered
+func RecordTwoFactorFailure(challenge string) error {
+	ctx := config.Ctx
+	challengeHash := hashToken(challenge)
+	attemptsKey := twoFactorAttemptsPrefix + challengeHash
+
+	attempts, err := config.RedisClient.Incr(ctx, attemptsKey).Result()
+	if err != nil {
+		return err
+	}
+	if attempts == 1 {
+		config.RedisClient.Expire(ctx, attemptsKey, TwoFactorChallengeTTL)
+	}
+	if attempts >= maxTwoFactorAttempts {
+		return config.RedisClient.Del(ctx, twoFactorChallengePrefix+challengeHash, attemptsKey).Err()
+	}
+	return nil
+}
+
+// CompleteTwoFactorChallenge deletes a challenge once the second step succeeded.
+// Only the first caller gets true, so a challenge cannot be used for two sessions.
+func CompleteTwoFactorChallenge(challenge string) (bool, error) {
+	challengeHash := hashToken(challenge)
+	deleted, err := config.RedisClient.Del(config.Ctx, twoFactorChallengePrefix+challengeHash).Result()
+	if err != nil {
+		return false, err
+	}
+	config.RedisClient.Del(config.Ctx, twoFactorAttemptsPrefix+challengeHash)
+	return deleted == 1, nil
+}